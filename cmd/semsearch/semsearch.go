@@ -1,44 +1,100 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/becojo/semsearch/pkg/cli"
+	"github.com/becojo/semsearch/pkg/config"
 	"github.com/becojo/semsearch/pkg/rule"
 )
 
 func main() {
 	args := os.Args[1:]
 
+	// Hidden command used by the completion scripts
+	if len(args) > 0 && args[0] == "__complete" {
+		fmt.Print(cli.Complete(completeArgs(args[1:])))
+		return
+	}
+
 	// Handle completion generation before normal CLI parsing
-	if len(args) == 1 && args[0] == "--bash-completion" {
-		fmt.Print(cli.GetBashCompletion())
+	if len(args) == 1 && strings.HasSuffix(args[0], "-completion") {
+		if script, ok := cli.CompletionScript(strings.TrimSuffix(strings.TrimPrefix(args[0], "--"), "-completion")); ok {
+			fmt.Print(script)
+			return
+		}
+	}
+
+	if len(args) == 1 && args[0] == "--list-options" {
+		fmt.Println(cli.OptionsHelp())
+		return
+	}
+
+	if len(args) == 1 && args[0] == "--print-config" {
+		os.Exit(printConfig())
+		return
+	}
+
+	if len(args) == 2 && args[0] == "--to-cli" {
+		os.Exit(toCLI(args[1]))
 		return
 	}
 
-	if showHelp(args) {
+	if len(args) == 0 {
 		fmt.Println(cli.Help())
 		return
 	}
 
-	state, err := cli.Parse(args)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err.Error())
-		os.Exit(1)
+	command, args := cli.SplitCommand(args)
+	if command.Name == cli.COMMAND_HELP {
+		os.Exit(help(args))
+		return
+	}
+	if cli.WantsHelp(args) {
+		fmt.Println(command.Help())
 		return
 	}
 
+	switch command.Name {
+	case cli.COMMAND_COMPLETION:
+		os.Exit(completion(args))
+	case cli.COMMAND_LINT:
+		os.Exit(lint(args))
+	case cli.COMMAND_EXPLAIN:
+		os.Exit(explain(args))
+	case cli.COMMAND_FMT:
+		os.Exit(format(args))
+	default:
+		os.Exit(run(command, args))
+	}
+}
+
+// Build the rules of the arguments and run them with the engine.
+func run(command cli.Command, args []string) int {
+	state, err := parse(args)
+	if err != nil {
+		printErrors(args, err)
+		return 1
+	}
+
 	if command := os.Getenv("SEMSEARCH_COMMAND"); command != "" {
 		state.Command(command)
 	}
+	if command.Name == cli.COMMAND_EXPORT {
+		state.Export()
+	}
 
 	runner := rule.NewRunner(state)
+	if command.Name == cli.COMMAND_TEST {
+		runner.Test()
+	}
 
 	if err := runner.Prepare(); err != nil {
-		fmt.Fprintln(os.Stderr, "error preparing runner:", err.Error())
-		os.Exit(1)
-		return
+		printErrors(args, err)
+		return 1
 	}
 
 	err = runner.Run()
@@ -46,25 +102,184 @@ func main() {
 		fmt.Fprintln(os.Stderr, "error running semsearch:", err.Error())
 	}
 
-	err = runner.Cleanup()
-	if err != nil {
+	if err := runner.Cleanup(); err != nil {
 		fmt.Fprintln(os.Stderr, "error cleaning up:", err.Error())
+		return 1
 	}
 
 	if err != nil {
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
-func showHelp(args []string) bool {
+// Parse the arguments and check the rules, printing the warnings. The state
+// is nil when the arguments cannot be parsed.
+func parse(args []string) (*rule.State, error) {
+	defaults, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := cli.ParseWith(defaults.Apply(rule.Builder()), args)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := state.Validate()
+	for _, warning := range state.Warnings() {
+		fmt.Fprintln(os.Stderr, formatDiagnostic(args, warning))
+	}
+	if err := state.Err(); err != nil {
+		return state, err
+	}
+	return state, validation
+}
+
+// Load the user and project configuration files.
+func loadConfig() (*config.Config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return config.Load(dir)
+}
+
+// Print the merged configuration.
+func printConfig() int {
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err.Error())
+		return 1
+	}
+	fmt.Print(c)
+	return 0
+}
+
+// Check the rules without running them. Warnings only fail the check with
+// --strict.
+func lint(args []string) int {
+	if _, err := parse(args); err != nil {
+		printErrors(args, err)
+		return 1
+	}
+	return 0
+}
+
+// Print the pattern tree of the rules, then their problems.
+func explain(args []string) int {
+	state, err := parse(args)
+	if state != nil {
+		fmt.Print(state.Tree())
+	}
+	if err != nil {
+		printErrors(args, err)
+		return 1
+	}
+	return 0
+}
+
+// Print the canonical arguments building the same rules.
+func format(args []string) int {
+	state, err := parse(args)
+	if err != nil {
+		printErrors(args, err)
+		return 1
+	}
+	defaults, err := loadConfig()
+	if err != nil {
+		printErrors(args, err)
+		return 1
+	}
+	canonical, unsupported := cli.Decompile(state.Rules())
+	run, dropped := cli.DecompileRun(state.RunOptions(), defaults.Apply(rule.Builder()).RunOptions())
+	for _, d := range append(unsupported, dropped...) {
+		fmt.Fprintln(os.Stderr, cli.FormatDiagnostic(nil, d))
+	}
+	fmt.Println("semsearch", cli.ShellJoin(append(canonical, run...)))
+	return 0
+}
+
+// Print the completion script of a shell.
+func completion(args []string) int {
+	if len(args) == 1 {
+		if script, ok := cli.CompletionScript(args[0]); ok {
+			fmt.Print(script)
+			return 0
+		}
+	}
+	command, _ := cli.LookupCommand(cli.COMMAND_COMPLETION)
+	fmt.Fprintln(os.Stderr, command.Help())
+	return 1
+}
+
+// Print the help of a command, or the general help.
+func help(args []string) int {
 	if len(args) == 0 {
-		return true
+		fmt.Println(cli.Help())
+		return 0
+	}
+	command, ok := cli.LookupCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown command '%s'\n", args[0])
+		return 1
 	}
+	fmt.Println(command.Help())
+	return 0
+}
 
-	for _, arg := range args {
-		if arg == "help" || arg == "--help" || arg == "-h" {
-			return true
+// Arguments of __complete. PowerShell gives the current word as
+// --current=<word> since it may drop an empty argument.
+func completeArgs(args []string) []string {
+	if len(args) > 0 {
+		if current, ok := strings.CutPrefix(args[len(args)-1], "--current="); ok {
+			args[len(args)-1] = current
 		}
 	}
-	return false
+	return args
+}
+
+// Print the arguments rebuilding the rules of a rule file.
+func toCLI(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err.Error())
+		return 1
+	}
+	rules, err := rule.ParseRules(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to parse rules in %s: %s\n", path, err.Error())
+		return 1
+	}
+
+	args, unsupported := cli.Decompile(rules)
+	for _, d := range unsupported {
+		fmt.Fprintln(os.Stderr, cli.FormatDiagnostic(nil, d))
+	}
+	fmt.Println("semsearch", cli.ShellJoin(args))
+	return 0
+}
+
+// Print the errors, the diagnostics with the offending argument.
+func printErrors(args []string, err error) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		var d *rule.Diagnostic
+		if errors.As(err, &d) {
+			fmt.Fprintln(os.Stderr, formatDiagnostic(args, d))
+			continue
+		}
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "error:", line)
+		}
+	}
+}
+
+// Format a diagnostic of the arguments following the command name, printing
+// the command line as it was given.
+func formatDiagnostic(args []string, d *rule.Diagnostic) string {
+	return cli.FormatCommandDiagnostic(os.Args[1:], args, d)
 }
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Subcommand of semsearch, the command line starts with its name. Without a
+// command name the command line is run.
+type Command struct {
+	Name string
+	// arguments in the usage
+	Usage       string
+	Description string
+	// help sections of the flags accepted by the command
+	Groups []string
+}
+
+const (
+	COMMAND_RUN        = "run"
+	COMMAND_EXPORT     = "export"
+	COMMAND_TEST       = "test"
+	COMMAND_LINT       = "lint"
+	COMMAND_FMT        = "fmt"
+	COMMAND_EXPLAIN    = "explain"
+	COMMAND_COMPLETION = "completion"
+	COMMAND_HELP       = "help"
+)
+
+// Help sections of the flags building the rules.
+var ruleGroups = []string{
+	GROUP_PATTERN,
+	GROUP_PATTERN_LIST,
+	GROUP_TAINT,
+	GROUP_RULE,
+	GROUP_JOIN,
+	GROUP_EXTRACT,
+}
+
+var Commands = []Command{
+	{Name: COMMAND_RUN, Usage: "[options] [-- paths...]", Description: "Run the rules with Opengrep (default command)",
+		Groups: groups},
+	{Name: COMMAND_EXPORT, Usage: "[options]", Description: "Output the rules as YAML instead of running them",
+		Groups: ruleGroups},
+	{Name: COMMAND_TEST, Usage: "[options] [-- paths...]", Description: "Test the rules on files annotated with ruleid: and ok: comments",
+		Groups: slices.Concat(ruleGroups, []string{GROUP_SEARCH, GROUP_RUN})},
+	{Name: COMMAND_LINT, Usage: "[options]", Description: "Check the rules for errors without running them, warnings fail with --strict",
+		Groups: ruleGroups},
+	{Name: COMMAND_FMT, Usage: "[options]", Description: "Print the canonical semsearch arguments building the rules",
+		Groups: slices.Concat(ruleGroups, []string{GROUP_SEARCH})},
+	{Name: COMMAND_EXPLAIN, Usage: "[options]", Description: "Show the pattern tree of the rules and their warnings",
+		Groups: ruleGroups},
+	{Name: COMMAND_COMPLETION, Usage: "<" + strings.Join(Shells, "|") + ">", Description: "Output the completion script of a shell"},
+	{Name: COMMAND_HELP, Usage: "[command]", Description: "Show the help of a command"},
+}
+
+// Shells with a completion script.
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+func LookupCommand(name string) (Command, bool) {
+	for _, command := range Commands {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+// Split the command from its arguments. The command line is run when it does
+// not start with a command name.
+func SplitCommand(args []string) (Command, []string) {
+	if len(args) > 0 {
+		if command, ok := LookupCommand(args[0]); ok {
+			return command, args[1:]
+		}
+	}
+	command, _ := LookupCommand(COMMAND_RUN)
+	return command, args
+}
+
+// Whether the arguments ask for help with -h or --help. Flag values and
+// paths are not checked.
+func WantsHelp(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--":
+			return false
+		case args[i] == "-h" || args[i] == "--help":
+			return true
+		case !strings.Contains(args[i], "="):
+			if _, ok := flags1[normalizeShortcut(args[i])]; ok {
+				i += 1
+			}
+		}
+	}
+	return false
+}
+
+// Help of a command, with the flags of its sections.
+func (c Command) Help() string {
+	if c.Name == COMMAND_RUN {
+		return Help()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage: semsearch %s %s\n\n%s.\n", c.Name, c.Usage, c.Description)
+	switch c.Name {
+	case COMMAND_COMPLETION:
+		b.WriteString("\nLoad the completion in the current shell with:\n")
+		b.WriteString("  source <(semsearch completion bash)\n")
+	case COMMAND_HELP:
+		b.WriteString(commandsHelp())
+	}
+	for _, group := range c.Groups {
+		writeGroup(&b, group)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Section listing the commands.
+func commandsHelp() string {
+	var b strings.Builder
+	b.WriteString("\nCommands:\n")
+	for _, command := range Commands {
+		b.WriteString(helpLine(command.Name+" "+command.Usage, command.Description) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	command, args := SplitCommand([]string{"lint", "-p", "foo"})
+	assert.Equal(t, COMMAND_LINT, command.Name)
+	assert.Equal(t, []string{"-p", "foo"}, args)
+
+	command, args = SplitCommand([]string{"-p", "lint"})
+	assert.Equal(t, COMMAND_RUN, command.Name)
+	assert.Equal(t, []string{"-p", "lint"}, args)
+}
+
+func TestWantsHelp(t *testing.T) {
+	assert.True(t, WantsHelp([]string{"-p", "foo", "--help"}))
+	assert.True(t, WantsHelp([]string{"-h"}))
+	assert.False(t, WantsHelp([]string{"-p", "-h"}))
+	assert.False(t, WantsHelp([]string{"-p", "help"}))
+	assert.False(t, WantsHelp([]string{"-p", "foo", "--", "-h"}))
+}
+
+func TestCommandHelp(t *testing.T) {
+	for _, command := range Commands {
+		help := command.Help()
+		assert.True(t, strings.HasPrefix(help, "Usage: semsearch "), command.Name)
+		assert.Contains(t, Help(), "  "+command.Name+" ", command.Name)
+	}
+	lint, _ := LookupCommand(COMMAND_LINT)
+	assert.Contains(t, lint.Help(), "--pattern <pattern>")
+	assert.NotContains(t, lint.Help(), "--format")
+}
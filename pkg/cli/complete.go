@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/becojo/semsearch/pkg/rule"
+)
+
+// Metavariable being written at the end of an expression.
+var trailingMetavariable = regexp.MustCompile(`\$(\.\.\.)?[A-Z0-9_]*$`)
+
+// Candidates completing the current word of a command line.
+type Completion struct {
+	Candidates []Candidate
+	// complete file names too, limited to the Glob pattern when set
+	Files bool
+	Glob  string
+	// the candidates are incomplete, such as name=, no space follows them
+	NoSpace bool
+}
+
+type Candidate struct {
+	Value       string
+	Description string
+}
+
+// Complete the last argument using the state built from the arguments before
+// it. The arguments are parsed up to the first error.
+func Complete(args []string) Completion {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	words, current := args[:len(args)-1], args[len(args)-1]
+
+	if slices.Contains(words, "--") {
+		return Completion{Files: true}
+	}
+
+	if len(words) == 0 && !strings.HasPrefix(current, "-") {
+		return completeCommands(current)
+	}
+
+	// standalone flags are only valid alone
+	standalone := len(words) == 0
+	if len(words) > 0 {
+		command, _ := LookupCommand(words[0])
+		switch {
+		case command.Name == COMMAND_COMPLETION && len(words) == 1:
+			return completeWords(current, Shells)
+		case command.Name == COMMAND_HELP && len(words) == 1:
+			return completeCommands(current)
+		case command.Name == COMMAND_COMPLETION || command.Name == COMMAND_HELP:
+			return Completion{}
+		case command.Name != "":
+			words = words[1:]
+		}
+	}
+
+	// value joined to its flag with =
+	if strings.HasPrefix(current, "-") && strings.Contains(current, "=") {
+		flag, value, _ := strings.Cut(current, "=")
+		f, ok := lookupFlag(flag)
+		if !ok || f.Arity == 0 {
+			return Completion{}
+		}
+		p := parsePartial(words)
+		return f.Complete.complete(p.state, value).prefix(flag + "=")
+	}
+
+	// value given as the next argument
+	if len(words) > 0 && !strings.Contains(words[len(words)-1], "=") {
+		if f, ok := lookupFlag(words[len(words)-1]); ok && f.Arity == 1 {
+			p := parsePartial(words[:len(words)-1])
+			return f.Complete.complete(p.state, current)
+		}
+	}
+
+	p := parsePartial(words)
+	c := Completion{}
+	if !strings.HasPrefix(current, "-") {
+		c.Candidates = p.structure()
+	}
+	for _, flag := range Flags {
+		if flag.Standalone && !standalone || flag.when != nil && !flag.when(p.state) {
+			continue
+		}
+		for _, word := range flag.words() {
+			c.Candidates = append(c.Candidates, Candidate{word, flag.Description})
+		}
+	}
+	return c.filter(current)
+}
+
+func completeCommands(current string) Completion {
+	c := Completion{}
+	for _, command := range Commands {
+		c.Candidates = append(c.Candidates, Candidate{command.Name, command.Description})
+	}
+	return c.filter(current)
+}
+
+// Parse the arguments up to the first error, without reading stdin.
+func parsePartial(args []string) *parser {
+	p := newParser(rule.Builder(), strings.NewReader(""))
+	_ = p.parse(args)
+	return p
+}
+
+// Brackets and ^ valid after the parsed arguments.
+func (p *parser) structure() []Candidate {
+	candidates := []Candidate{}
+	if p.group {
+		candidates = append(candidates,
+			Candidate{"(", "Open the group of the previous flag"},
+			Candidate{"[", "Open the group of the previous flag"})
+	}
+	depth := 0
+	if len(p.brackets) > 0 {
+		open := p.brackets[len(p.brackets)-1]
+		depth = open.depth
+		candidates = append(candidates, Candidate{open.closing, "Close the pattern group"})
+	}
+	if p.state.Depth() > depth {
+		candidates = append(candidates, Candidate{"^", "Exit the current pattern group"})
+	}
+	return candidates
+}
+
+// Candidates completing a value of the completer.
+func (c Completer) complete(state *rule.State, value string) Completion {
+	switch c.Kind {
+	case COMPLETE_WORDS:
+		return completeWords(value, c.Words)
+	case COMPLETE_FILES:
+		return Completion{Files: true, Glob: c.Glob}
+	case COMPLETE_METAVARIABLES:
+		if name, rest, ok := strings.Cut(value, ":"); ok && len(c.Values) > 0 {
+			return completeWords(rest, c.Values).prefix(name + ":")
+		}
+		return completeWords(value, state.Metavariables())
+	case COMPLETE_METAVARIABLE_KEYS:
+		if name, rest, ok := strings.Cut(value, "="); ok {
+			return completeWords(rest, c.Values).prefix(name + "=")
+		}
+		keys := []string{}
+		for _, name := range state.Metavariables() {
+			keys = append(keys, name+"=")
+		}
+		completion := completeWords(value, keys)
+		completion.NoSpace = true
+		return completion
+	case COMPLETE_METAVARIABLE_REFS:
+		// complete the metavariable at the end of the expression, or add one
+		i := len(value)
+		if loc := trailingMetavariable.FindStringIndex(value); loc != nil {
+			i = loc[0]
+		}
+		refs := []string{}
+		for _, name := range state.Metavariables() {
+			refs = append(refs, "$"+name)
+		}
+		return completeWords(value[i:], refs).prefix(value[:i])
+	case COMPLETE_OPTIONS:
+		if name, rest, ok := strings.Cut(value, "="); ok {
+			option, _ := rule.LookupOption(name)
+			if option.Type != rule.OPTION_BOOL {
+				return Completion{}
+			}
+			return completeWords(rest, []string{"true", "false"}).prefix(name + "=")
+		}
+		c := Completion{NoSpace: true}
+		for _, option := range rule.Options {
+			c.Candidates = append(c.Candidates, Candidate{option.Name + "=", option.Description})
+		}
+		return c.filter(value)
+	}
+	return Completion{}
+}
+
+func completeWords(current string, words []string) Completion {
+	c := Completion{}
+	for _, word := range words {
+		c.Candidates = append(c.Candidates, Candidate{Value: word})
+	}
+	return c.filter(current)
+}
+
+// Keep the candidates starting with the current word.
+func (c Completion) filter(current string) Completion {
+	c.Candidates = slices.DeleteFunc(c.Candidates, func(candidate Candidate) bool {
+		return !strings.HasPrefix(candidate.Value, current)
+	})
+	return c
+}
+
+// Prepend the part of the word before the completed value to the candidates.
+func (c Completion) prefix(prefix string) Completion {
+	for i := range c.Candidates {
+		c.Candidates[i].Value = prefix + c.Candidates[i].Value
+	}
+	return c
+}
+
+// Output read by the completion scripts: one candidate per line with its
+// description after a tab, then the directives :files [glob] and :nospace.
+func (c Completion) String() string {
+	var b strings.Builder
+	for _, candidate := range c.Candidates {
+		b.WriteString(candidate.Value)
+		if candidate.Description != "" {
+			b.WriteString("\t" + candidate.Description)
+		}
+		b.WriteString("\n")
+	}
+	if c.Files {
+		b.WriteString(strings.TrimSpace(":files "+c.Glob) + "\n")
+	}
+	if c.NoSpace {
+		b.WriteString(":nospace\n")
+	}
+	return b.String()
+}
+
+// Flag written as --name or -shortcut.
+func lookupFlag(word string) (Flag, bool) {
+	name := normalizeShortcut(word)
+	for _, flag := range Flags {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func values(c Completion) []string {
+	values := []string{}
+	for _, candidate := range c.Candidates {
+		values = append(values, candidate.Value)
+	}
+	return values
+}
+
+func TestCompleteMetavariables(t *testing.T) {
+	tests := []struct {
+		args   []string
+		values []string
+	}{
+		{[]string{"-p", "foo($X, $...ARGS)", "-fm", ""}, []string{"...ARGS", "X"}},
+		{[]string{"-p", "foo($X)", "-pr", "(?P<NAME>.*)", "-mr", "N"}, []string{"NAME="}},
+		{[]string{"-p", "foo($X)", "-mr=X"}, []string{"-mr=X="}},
+		{[]string{"-p", "foo($X)", "-ma", "X=e"}, []string{"X=entropy"}},
+		{[]string{"-p", "foo($X, $Y)", "-mc", "$X > $"}, []string{"$X > $X", "$X > $Y"}},
+		{[]string{"-p", "foo($X, $Y)", "-mc", "$X > "}, []string{"$X > $X", "$X > $Y"}},
+		{[]string{"-p", "foo($X, $YES)", "-mc", "$X > $Y"}, []string{"$X > $YES"}},
+		{[]string{"-p", "foo($X)", "-mc", "int($X) == 1 or "}, []string{"int($X) == 1 or $X"}},
+		{[]string{"-p", "foo($X)", "-mp", "X:ya"}, []string{"X:yaml"}},
+		{[]string{"-p", "foo($X)", "--rule", "-p", "bar($Y)", "-fm", ""}, []string{"Y"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.values, values(Complete(test.args)), test.args)
+	}
+}
+
+func TestCompleteStructure(t *testing.T) {
+	tests := []struct {
+		args   []string
+		values []string
+	}{
+		{[]string{"-p", "foo", ""}, []string{}},
+		{[]string{"-pe", ""}, []string{"(", "[", "^"}},
+		{[]string{"-pe", "-p", "a", ""}, []string{"^"}},
+		{[]string{"-pe", "[", "-p", "a", ""}, []string{"]"}},
+		{[]string{"-pe", "[", "-ps", "-p", "a", ""}, []string{"]", "^"}},
+		{[]string{"-ps", "(", "-pe", "[", "-p", "a", "]", ""}, []string{")"}},
+	}
+
+	for _, test := range tests {
+		c := Complete(test.args)
+		structure := []string{}
+		for _, value := range values(c) {
+			if _, ok := closingBrackets[value]; ok || value == ")" || value == "]" || value == "^" {
+				structure = append(structure, value)
+			}
+		}
+		assert.Equal(t, test.values, structure, test.args)
+	}
+}
+
+func TestCompleteFlagsInContext(t *testing.T) {
+	tests := []struct {
+		args     []string
+		included []string
+		excluded []string
+	}{
+		{[]string{"-p", "a", "--"}, []string{"--pattern", "--rule"}, []string{"--label", "--on", "--propagate-to", "--pop", "--to-cli"}},
+		{[]string{"-pso", "--"}, []string{"--label", "--control", "--exact"}, []string{"--propagate-to"}},
+		{[]string{"-psk", "--"}, []string{"--requires", "--exact"}, []string{"--label", "--control", "--by-side-effect"}},
+		{[]string{"-psa", "--"}, []string{"--by-side-effect"}, []string{"--label", "--requires"}},
+		{[]string{"-ppr", "--"}, []string{"--propagate-from", "--propagate-to"}, []string{"--label"}},
+		{[]string{"-p", "a", "--rule", "-p", "b", "--join", "--"}, []string{"--on", "--join-ref"}, []string{"--pattern", "--pattern-inside"}},
+		{[]string{"-p", "a", "^", "--"}, []string{"--rule"}, []string{"--pattern", "--patterns"}},
+		{[]string{"--"}, []string{"--to-cli", "--list-options"}, []string{}},
+	}
+
+	for _, test := range tests {
+		completed := values(Complete(test.args))
+		for _, flag := range test.included {
+			assert.Contains(t, completed, flag, test.args)
+		}
+		for _, flag := range test.excluded {
+			assert.NotContains(t, completed, flag, test.args)
+		}
+	}
+}
+
+func TestCompleteTaintValues(t *testing.T) {
+	tests := []struct {
+		args   []string
+		output string
+	}{
+		{[]string{"-pso", "--by-side-effect", ""}, "true\nfalse\nonly\n"},
+		{[]string{"-psa", "--by-side-effect=o"}, "--by-side-effect=only\n"},
+		{[]string{"-psk", "--exact", "f"}, "false\n"},
+		{[]string{"-pso", "--label", ""}, ""},
+		{[]string{"-psk", "--requires", ""}, ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.output, Complete(test.args).String(), test.args)
+	}
+}
+
+func TestCompleteOutput(t *testing.T) {
+	assert.Equal(t, ":files *.sq\n", Complete([]string{"-q", ""}).String())
+	assert.Equal(t, ":files\n", Complete([]string{"-p", "a", "--", ""}).String())
+	assert.Equal(t, "help\tShow the help of a command\n", Complete([]string{"h"}).String())
+	assert.Equal(t, "--option=ac_matching=true\n", Complete([]string{"--option=ac_matching=t"}).String())
+	assert.Equal(t, "ac_matching=\tMatch associative and commutative operators in any order\n:nospace\n", Complete([]string{"--option", "ac_m"}).String())
+	assert.Equal(t, "--severity\tSet the severity of the rule\n", Complete([]string{"-p", "a", "--sev"}).String())
+}
+
+func TestCompleteCommands(t *testing.T) {
+	assert.Equal(t, []string{"export", "explain"}, values(Complete([]string{"ex"})))
+	assert.Equal(t, []string{"fish"}, values(Complete([]string{"completion", "f"})))
+	assert.Equal(t, []string{"lint"}, values(Complete([]string{"help", "l"})))
+	assert.Equal(t, []string{"X"}, values(Complete([]string{"lint", "-p", "$X", "-fm", ""})))
+	assert.NotContains(t, values(Complete([]string{"export", "--"})), "--to-cli")
+}
@@ -0,0 +1,19 @@
+# Complete the current word with the candidates of semsearch __complete
+function __semsearch_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    for line in ($tokens[1] __complete $tokens[2..-1] "$current" 2>/dev/null)
+        switch $line
+            case ':nospace'
+                # no space follows a candidate ending with =
+            case ':files'
+                __fish_complete_path $current
+            case ':files *'
+                __fish_complete_suffix (string replace -r '^:files \*' '' -- $line)
+            case '*'
+                echo $line
+        end
+    end
+end
+
+complete -c semsearch -f -a '(__semsearch_complete)'
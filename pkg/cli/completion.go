@@ -1,11 +1,64 @@
 package cli
 
-import _ "embed"
+import (
+	_ "embed"
+)
+
+// The completion scripts complete the command line with the candidates of the
+// hidden __complete command, see Complete.
 
 //go:embed completion.bash
 var bashCompletion string
 
+//go:embed completion.zsh
+var zshCompletion string
+
+//go:embed completion.fish
+var fishCompletion string
+
+//go:embed completion.ps1
+var powershellCompletion string
+
 // GetBashCompletion returns the bash completion script
 func GetBashCompletion() string {
 	return bashCompletion
 }
+
+// GetZshCompletion returns the zsh completion script
+func GetZshCompletion() string {
+	return zshCompletion
+}
+
+// GetFishCompletion returns the fish completion script
+func GetFishCompletion() string {
+	return fishCompletion
+}
+
+// GetPowerShellCompletion returns the PowerShell completion script
+func GetPowerShellCompletion() string {
+	return powershellCompletion
+}
+
+// Words the flag is written as on the command line.
+func (f Flag) words() []string {
+	words := []string{"--" + f.Name}
+	if f.Shortcut != "" && f.Shortcut != "^" {
+		words = append(words, "-"+f.Shortcut)
+	}
+	return words
+}
+
+// Completion script of the shell, one of Shells.
+func CompletionScript(shell string) (string, bool) {
+	switch shell {
+	case "bash":
+		return GetBashCompletion(), true
+	case "zsh":
+		return GetZshCompletion(), true
+	case "fish":
+		return GetFishCompletion(), true
+	case "powershell":
+		return GetPowerShellCompletion(), true
+	}
+	return "", false
+}
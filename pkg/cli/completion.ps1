@@ -0,0 +1,30 @@
+Register-ArgumentCompleter -Native -CommandName semsearch -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $elements = @($commandAst.CommandElements | Where-Object { $_.Extent.EndOffset -le $cursorPosition } | ForEach-Object { $_.Extent.Text.Trim("'", '"') })
+    if ($wordToComplete -ne '') {
+        $elements = @($elements | Select-Object -SkipLast 1)
+    }
+    $command = $elements[0]
+    $arguments = @($elements | Select-Object -Skip 1)
+
+    # The current word is given as --current=<word> because an empty argument
+    # may not be passed to the command
+    $output = & $command __complete @arguments "--current=$wordToComplete" 2>$null
+
+    # No result falls back to the path completion, for :files
+    foreach ($line in $output) {
+        if ($line -like ':*') {
+            continue
+        }
+        $value, $description = $line -split "`t", 2
+        if (-not $description) {
+            $description = $value
+        }
+        $text = $value
+        if ($value -match '[\s$''"`(){}]') {
+            $text = "'" + $value.Replace("'", "''") + "'"
+        }
+        [System.Management.Automation.CompletionResult]::new($text, $value, 'ParameterValue', $description)
+    }
+}
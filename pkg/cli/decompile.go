@@ -0,0 +1,423 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/becojo/semsearch/pkg/rule"
+)
+
+// Decompile rules into the arguments that rebuild them with Parse, the
+// inverse of Parse. Constructs without an equivalent flag are left out and
+// reported.
+func Decompile(rules []*rule.Rule) ([]string, []*rule.Diagnostic) {
+	d := &decompiler{severity: rule.SEVERITY_WARNING}
+	for i, r := range rules {
+		switch {
+		case r == nil:
+			d.report(&rule.Rule{}, "empty rule %d cannot be expressed", i+1)
+			continue
+		case r.Join != nil && i > 0:
+			d.report(r, "join rule must be the first rule, it combines the rules before it")
+			continue
+		case r.Join != nil:
+			d.join(r)
+		default:
+			d.rule(r, i > 0)
+		}
+	}
+	return d.args, d.unsupported
+}
+
+// Convert the run options back to flags. The options equal to the defaults,
+// such as those of the configuration files, are left out.
+func DecompileRun(options, defaults rule.RunOptions) ([]string, []*rule.Diagnostic) {
+	d := &decompiler{}
+	for _, eval := range options.Evals {
+		d.emit("-e", eval)
+	}
+	for _, config := range options.Configs[min(len(defaults.Configs), len(options.Configs)):] {
+		d.emit("-c", config)
+	}
+	if options.Format != defaults.Format {
+		d.emit("--format", options.Format)
+	}
+	switch options.Command {
+	case defaults.Command:
+	case rule.ENGINE_SEMGREP:
+		d.emit("--semgrep")
+	default:
+		d.unsupported = append(d.unsupported, &rule.Diagnostic{
+			Severity: rule.DIAGNOSTIC_WARNING,
+			Message:  fmt.Sprintf("command '%s' cannot be expressed", options.Command),
+		})
+	}
+	flags := []struct {
+		set  bool
+		flag string
+	}{
+		{options.Autofix, "--autofix"},
+		{options.Strict, "--strict"},
+		{options.Debug, "--debug"},
+		{options.Verbose, "--verbose"},
+		{options.Export, "--export"},
+	}
+	for _, f := range flags {
+		if f.set {
+			d.emit(f.flag)
+		}
+	}
+	for _, path := range options.Paths {
+		d.emit("-i", path)
+	}
+	return d.args, d.unsupported
+}
+
+// Quote the arguments for a POSIX shell.
+func ShellJoin(args []string) string {
+	quoted := []string{}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+type decompiler struct {
+	args        []string
+	unsupported []*rule.Diagnostic
+
+	// languages and severity a new rule inherits from the previous one
+	languages []string
+	severity  string
+
+	// rule being decompiled
+	current *rule.Rule
+}
+
+// Emit a flag and its value, escaped so it is not read from a file.
+func (d *decompiler) emit(flag string, value ...string) {
+	if slices.Contains(value, "-") {
+		d.report(d.current, "value '-' of %s cannot be expressed, it reads stdin", flag)
+		return
+	}
+	d.args = append(d.args, flag)
+	for _, v := range value {
+		if strings.HasPrefix(v, "@") {
+			v = "@" + v
+		}
+		d.args = append(d.args, v)
+	}
+}
+
+func (d *decompiler) report(r *rule.Rule, format string, args ...any) {
+	d.unsupported = append(d.unsupported, &rule.Diagnostic{
+		Severity: rule.DIAGNOSTIC_WARNING,
+		Rule:     r.Id,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *decompiler) join(r *rule.Rule) {
+	d.current = r
+	if len(r.Join.Rules) == 0 {
+		d.report(r, "join rule without inline rules cannot be expressed, --join combines the rules before it")
+		return
+	}
+	for i, child := range r.Join.Rules {
+		if child == nil {
+			d.report(r, "empty join rule %d cannot be expressed", i+1)
+			continue
+		}
+		if child.Join != nil {
+			d.report(child, "nested join rule cannot be expressed")
+			continue
+		}
+		d.rule(child, i > 0)
+	}
+	d.current = r
+	d.emit("--join")
+	d.attributes(r)
+	for _, ref := range r.Join.Refs {
+		if ref.As != "" {
+			d.emit("--join-ref", ref.As+"="+ref.Rule)
+		} else {
+			d.emit("--join-ref", ref.Rule)
+		}
+	}
+	for _, condition := range r.Join.On {
+		d.emit("--on", condition)
+	}
+}
+
+func (d *decompiler) rule(r *rule.Rule, next bool) {
+	d.current = r
+	if next {
+		d.emit("--rule")
+	}
+	d.attributes(r)
+
+	if r.Patterns != nil {
+		d.patterns(r, *r.Patterns)
+	}
+	d.taint(r, "-pso", r.PatternSources)
+	d.taint(r, "-psk", r.PatternSinks)
+	d.taint(r, "-psa", r.PatternSanitizers)
+	if r.PatternPropagators != nil {
+		for _, p := range *r.PatternPropagators {
+			d.emit("-ppr")
+			if p.From != "" {
+				d.emit("--propagate-from", p.From)
+			}
+			if p.To != "" {
+				d.emit("--propagate-to", p.To)
+			}
+			d.patterns(r, *p.Patterns)
+		}
+	}
+
+	// the groups are left when the next rule starts
+	for len(d.args) > 0 && d.args[len(d.args)-1] == "^" {
+		d.args = d.args[:len(d.args)-1]
+	}
+
+	if r.Extract != "" && r.DestLanguage != "" {
+		d.languages = []string{r.DestLanguage}
+	} else {
+		d.languages = r.Languages
+	}
+	d.severity = r.Severity
+}
+
+// Emit the flags setting the properties of the rule.
+func (d *decompiler) attributes(r *rule.Rule) {
+	if !r.GeneratedID() {
+		d.emit("--id", r.Id)
+	}
+	d.language(r)
+	if r.Severity != "" && r.Severity != d.severity {
+		d.emit("-sv", r.Severity)
+	}
+	if r.Message != "" {
+		d.emit("-m", r.Message)
+	}
+	if r.MinVersion != "" {
+		d.emit("--min-version", r.MinVersion)
+	}
+	if r.MaxVersion != "" {
+		d.emit("--max-version", r.MaxVersion)
+	}
+	if r.Paths != nil {
+		for _, path := range r.Paths.Include {
+			d.emit("--path-include", path)
+		}
+		for _, path := range r.Paths.Exclude {
+			d.emit("--path-exclude", path)
+		}
+	}
+	d.options(r)
+	d.metadata(r)
+
+	if r.FixRegex != "" {
+		d.emit("-fr", r.FixRegex)
+		if r.FixCount > 0 {
+			d.report(r, "fix-regex count %d cannot be expressed", r.FixCount)
+		}
+	}
+	if r.Fix != "" {
+		d.emit("-fx", r.Fix)
+	}
+
+	if r.Extract != "" {
+		d.emit("--extract", r.Extract)
+	}
+	if r.DestLanguage != "" {
+		d.emit("--dest-language", r.DestLanguage)
+	}
+	for _, id := range r.DestRules {
+		d.emit("--dest-rules", id)
+	}
+	if r.Transform != "" {
+		d.emit("--transform", r.Transform)
+	}
+	if r.Reduce != "" {
+		d.emit("--reduce", r.Reduce)
+	}
+
+	for _, item := range r.Extra {
+		d.report(r, "unsupported key '%v' cannot be expressed", item.Key)
+	}
+}
+
+// New rules start with the languages of the previous rule, so only the
+// languages added to them can be expressed.
+func (d *decompiler) language(r *rule.Rule) {
+	inherited, languages := d.languages, r.Languages
+	if len(inherited) == 0 && slices.Equal(languages, []string{"generic"}) {
+		return
+	}
+	if len(languages) < len(inherited) || !slices.Equal(languages[:len(inherited)], inherited) {
+		d.report(r, "languages [%s] cannot be expressed, the rule inherits [%s] from the previous rule",
+			strings.Join(languages, ", "), strings.Join(inherited, ", "))
+		return
+	}
+	for _, language := range languages[len(inherited):] {
+		d.emit("-l", language)
+	}
+}
+
+func (d *decompiler) options(r *rule.Rule) {
+	for _, name := range sortedKeys(r.Options) {
+		var value string
+		switch v := r.Options[name].(type) {
+		case []any:
+			items := []string{}
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			value = strings.Join(items, ",")
+		case []string:
+			value = strings.Join(v, ",")
+		case string, bool, int:
+			value = fmt.Sprint(v)
+		default:
+			d.report(r, "option '%s' cannot be expressed", name)
+			continue
+		}
+		if _, ok := rule.LookupOption(name); !ok {
+			if _, ok := r.Options[name].(string); !ok {
+				d.report(r, "unknown option '%s' with a non-string value cannot be expressed", name)
+				continue
+			}
+		}
+		d.emit("--option", name+"="+value)
+	}
+}
+
+func (d *decompiler) metadata(r *rule.Rule) {
+	for _, key := range sortedKeys(r.Metadata) {
+		if strings.ContainsAny(key, ".=") {
+			d.report(r, "metadata key '%s' cannot be expressed, '.' nests and '=' separates the value", key)
+			continue
+		}
+		if value, ok := r.Metadata[key].(string); ok {
+			d.emit("--metadata", key+"="+value)
+			continue
+		}
+		value, err := json.Marshal(r.Metadata[key])
+		if err != nil {
+			d.report(r, "metadata '%s' cannot be expressed: %v", key, err)
+			continue
+		}
+		d.emit("--metadata-json", key+"="+string(value))
+	}
+}
+
+func (d *decompiler) taint(r *rule.Rule, flag string, specs *[]rule.TaintSpec) {
+	if specs == nil {
+		return
+	}
+	for _, spec := range *specs {
+		d.emit(flag)
+		if spec.Label != "" {
+			d.emit("--label", spec.Label)
+		}
+		if spec.Requires != "" {
+			d.emit("--requires", spec.Requires)
+		}
+		if spec.BySideEffect != "" {
+			d.emit("--by-side-effect", spec.BySideEffect)
+		}
+		if spec.Exact != nil {
+			d.emit("--exact", fmt.Sprint(*spec.Exact))
+		}
+		if spec.Control {
+			d.emit("--control")
+		}
+		if spec.Patterns != nil {
+			d.patterns(r, *spec.Patterns)
+		}
+	}
+}
+
+func (d *decompiler) patterns(r *rule.Rule, patterns []rule.Pattern) {
+	for _, p := range patterns {
+		d.pattern(r, p)
+	}
+}
+
+func (d *decompiler) pattern(r *rule.Rule, p rule.Pattern) {
+	switch {
+	case p.Pattern != "":
+		d.emit("-p", p.Pattern)
+	case p.PatternNot != "":
+		d.emit("-pn", p.PatternNot)
+	case p.PatternInside != "":
+		d.emit("-pi", p.PatternInside)
+	case p.PatternNotInside != "":
+		d.emit("-pni", p.PatternNotInside)
+	case p.PatternRegex != "":
+		d.emit("-pr", p.PatternRegex)
+	case p.PatternNotRegex != "":
+		d.emit("-pnr", p.PatternNotRegex)
+	case p.FocusMetavariable != "":
+		d.emit("-fm", p.FocusMetavariable)
+	case p.MetavariableRegex != nil:
+		d.emit("-mr", p.MetavariableRegex.Metavariable+"="+p.MetavariableRegex.Regex)
+	case p.MetavariableComparison != nil:
+		c := p.MetavariableComparison
+		d.emit("-mc", c.Comparison)
+		if c.Metavariable != "" {
+			d.emit("--comparison-metavariable", c.Metavariable)
+		}
+		if c.Base != 0 {
+			d.emit("--comparison-base", fmt.Sprint(c.Base))
+		}
+		if c.Strip {
+			d.emit("--comparison-strip")
+		}
+	case p.MetavariableAnalysis != nil:
+		d.emit("-ma", p.MetavariableAnalysis.Metavariable+"="+p.MetavariableAnalysis.Analyzer)
+	case p.MetavariableType != nil:
+		d.emit("-mt", p.MetavariableType.Metavariable+"="+p.MetavariableType.Type)
+	case p.MetavariableName != nil:
+		d.emit("-mn", p.MetavariableName.Metavariable+"="+p.MetavariableName.Module)
+	case p.MetavariablePattern != nil && p.MetavariablePattern.PatternRegex != "":
+		m := p.MetavariablePattern
+		if m.Language != "" || m.Patterns != nil {
+			d.report(r, "metavariable-pattern with pattern-regex and a language or patterns cannot be expressed")
+		}
+		d.emit("-mpr", m.Metavariable+"="+m.PatternRegex)
+	case p.MetavariablePattern != nil:
+		m := p.MetavariablePattern
+		if m.Language != "" {
+			d.emit("-mp", m.Metavariable+":"+m.Language)
+		} else {
+			d.emit("-mp", m.Metavariable)
+		}
+		if m.Patterns != nil {
+			d.patterns(r, *m.Patterns)
+		}
+		d.emit("^")
+	case p.Patterns != nil:
+		d.emit("-ps")
+		d.patterns(r, *p.Patterns)
+		d.emit("^")
+	case p.PatternEither != nil:
+		d.emit("-pe")
+		d.patterns(r, *p.PatternEither)
+		d.emit("^")
+	default:
+		d.report(r, "empty pattern cannot be expressed")
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/becojo/semsearch/pkg/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompileRoundTrip(t *testing.T) {
+	yaml := `rules:
+- id: first
+  severity: ERROR
+  message: '@user said'
+  languages:
+  - go
+  min-version: 1.0.0
+  options:
+    symbolic_propagation: true
+  patterns:
+  - pattern: foo($X)
+  - pattern-either:
+    - pattern: bar
+    - patterns:
+      - pattern: baz($X)
+      - metavariable-regex:
+          metavariable: $X
+          regex: ^a
+  - metavariable-pattern:
+      metavariable: $X
+      language: python
+      patterns:
+      - pattern: x
+  - metavariable-pattern:
+      metavariable: $X
+      pattern-regex: ^[a-z]+$
+  - metavariable-comparison:
+      metavariable: $X
+      comparison: $X > 644
+      base: 8
+      strip: true
+  - focus-metavariable: $X
+  fix: qux($X)
+  metadata:
+    cwe:
+    - CWE-1
+    owner: team
+- id: second
+  severity: ERROR
+  message: ""
+  languages:
+  - go
+  mode: taint
+  pattern-sources:
+  - pattern: input()
+    label: USER
+  pattern-sinks:
+  - pattern: exec(...)
+    requires: USER
+`
+	rules, err := rule.ParseRules([]byte(yaml))
+	require.NoError(t, err)
+
+	args, unsupported := Decompile(rules)
+	assert.Empty(t, unsupported)
+
+	state, err := Parse(args)
+	require.NoError(t, err)
+	actual, err := state.MarshalRules()
+	require.NoError(t, err)
+	assert.Equal(t, yaml, string(actual))
+}
+
+func TestDecompileExtract(t *testing.T) {
+	yaml := `rules:
+- id: run
+  severity: WARNING
+  message: ""
+  languages:
+  - yaml
+  mode: extract
+  patterns:
+  - pattern: 'run: $CMD'
+  extract: $CMD
+  dest-language: bash
+  dest-rules:
+  - curl-pipe-sh
+  reduce: separate
+- id: curl-pipe-sh
+  severity: WARNING
+  message: ""
+  languages:
+  - bash
+  patterns:
+  - pattern: curl ... | sh
+`
+	rules, err := rule.ParseRules([]byte(yaml))
+	require.NoError(t, err)
+
+	args, unsupported := Decompile(rules)
+	assert.Empty(t, unsupported)
+	assert.Contains(t, ShellJoin(args), "--dest-rules curl-pipe-sh")
+
+	state, err := Parse(args)
+	require.NoError(t, err)
+	actual, err := state.MarshalRules()
+	require.NoError(t, err)
+	assert.Equal(t, yaml, string(actual))
+}
+
+func TestDecompileUnsupported(t *testing.T) {
+	rules, err := rule.ParseRules([]byte(`rules:
+- id: first
+  languages: [go]
+  pattern: foo
+  fix-regex:
+    regex: a
+    replacement: b
+    count: 2
+  custom: true
+- id: second
+  languages: [python]
+  pattern: "-"
+`))
+	require.NoError(t, err)
+
+	_, unsupported := Decompile(rules)
+	messages := []string{}
+	for _, d := range unsupported {
+		messages = append(messages, d.Error())
+	}
+	assert.Equal(t, []string{
+		"first: fix-regex count 2 cannot be expressed",
+		"first: unsupported key 'custom' cannot be expressed",
+		"second: languages [python] cannot be expressed, the rule inherits [go] from the previous rule",
+		"second: value '-' of -p cannot be expressed, it reads stdin",
+	}, messages)
+}
+
+func TestDecompileEmptyRules(t *testing.T) {
+	join := &rule.Rule{Id: "both", Join: &rule.RuleJoin{Rules: []*rule.Rule{nil, {Id: "a", Patterns: &[]rule.Pattern{{Pattern: "a"}}}}}}
+	args, unsupported := Decompile([]*rule.Rule{join, nil})
+	messages := []string{}
+	for _, d := range unsupported {
+		messages = append(messages, d.Error())
+	}
+	assert.Equal(t, []string{
+		"both: empty join rule 1 cannot be expressed",
+		"empty rule 2 cannot be expressed",
+	}, messages)
+	assert.Contains(t, args, "--join")
+}
+
+func TestDecompileCommandLine(t *testing.T) {
+	args := []string{"-p", "foo($X)", "-e", "foo(1)", "--json", "-c", "extra.yaml", "--autofix", "-i", "src", "--rule", "--id", "named", "-p", "bar"}
+	state, err := Parse(args)
+	require.NoError(t, err)
+
+	canonical, unsupported := Decompile(state.Rules())
+	assert.Empty(t, unsupported)
+	assert.Equal(t, "-p 'foo($X)' --rule --id named -p bar", ShellJoin(canonical))
+
+	defaults := rule.Builder().Config("default.yaml").Format("sarif")
+	state, err = ParseWith(rule.Builder().Config("default.yaml").Format("sarif"), append(args, "-ps"))
+	require.NoError(t, err)
+	run, dropped := DecompileRun(state.RunOptions(), defaults.RunOptions())
+	assert.Empty(t, dropped)
+	assert.Equal(t, "-e 'foo(1)' -c extra.yaml --format json --autofix -i src", ShellJoin(run))
+
+	state.Command("/opt/engine")
+	_, dropped = DecompileRun(state.RunOptions(), defaults.RunOptions())
+	if assert.Len(t, dropped, 1) {
+		assert.Equal(t, "command '/opt/engine' cannot be expressed", dropped[0].Message)
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	assert.Equal(t, `-p 'foo($X)' -m 'it'\''s' -e $'a\nb' -l go ''`, ShellJoin([]string{"-p", "foo($X)", "-m", "it's", "-e", "a\nb", "-l", "go", ""}))
+}
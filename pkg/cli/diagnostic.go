@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/becojo/semsearch/pkg/rule"
+)
+
+// Format a diagnostic for the terminal. When it comes from an argument, the
+// command line is printed with a caret under the offending argument.
+//
+//	error: unknown flag '--pattern-insde'
+//	  semsearch -p 'foo()' --pattern-insde 'bar()'
+//	                       ^^^^^^^^^^^^^^^
+//	hint: did you mean --pattern-inside?
+func FormatDiagnostic(args []string, d *rule.Diagnostic) string {
+	var b strings.Builder
+
+	message := d.Message
+	if d.Rule != "" {
+		message = fmt.Sprintf("%s: %s", d.Rule, message)
+	}
+	fmt.Fprintf(&b, "%s: %s\n", d.Severity, message)
+
+	if d.Flag != "" && d.Index < len(args) {
+		line, offset, width := "semsearch", 0, 0
+		for i, arg := range args {
+			quoted := shellQuote(arg)
+			if i == d.Index {
+				offset, width = utf8.RuneCountInString(line)+1, utf8.RuneCountInString(quoted)
+			}
+			line += " " + quoted
+		}
+		fmt.Fprintf(&b, "  %s\n", line)
+		fmt.Fprintf(&b, "  %s%s\n", strings.Repeat(" ", offset), strings.Repeat("^", width))
+	}
+
+	if d.Hint != "" {
+		fmt.Fprintf(&b, "hint: %s\n", d.Hint)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Format a diagnostic of the arguments parsed after the command name. The
+// whole command line is printed, with the caret moved past the command name.
+//
+//	error: unknown flag '--pattern-insde'
+//	  semsearch lint -p 'foo()' --pattern-insde 'bar()'
+//	                            ^^^^^^^^^^^^^^^
+func FormatCommandDiagnostic(commandLine []string, args []string, d *rule.Diagnostic) string {
+	if d.Flag != "" {
+		shifted := *d
+		shifted.Index += len(commandLine) - len(args)
+		d = &shifted
+	}
+	return FormatDiagnostic(commandLine, d)
+}
+
+// Quote an argument for a POSIX shell when needed.
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if !strings.ContainsFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,@%+^", r))
+	}) {
+		return arg
+	}
+	if strings.ContainsAny(arg, "\n\t\r") {
+		// ANSI-C quoting keeps the argument on one line
+		replacer := strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+		return "$'" + replacer.Replace(arg) + "'"
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
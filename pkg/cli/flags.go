@@ -1,97 +1,412 @@
 package cli
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/becojo/semsearch/pkg/query"
 	"github.com/becojo/semsearch/pkg/rule"
 )
 
-var shortcuts = map[string]string{
+// Command line flag. Help, completion and the parser are generated from the
+// flags.
+type Flag struct {
+	// name used as --name
+	Name string
+	// short name used as -shortcut
+	Shortcut string
+	// number of values, 0 or 1
+	Arity int
+	// help section of the flag
+	Group string
+	// name of the value in the help
+	Value       string
+	Description string
+	// completion of the value
+	Complete Completer
+	// handled by the command before parsing, used alone
+	Standalone bool
+	// a bracket may follow the flag to delimit the group it starts
+	Brackets bool
+	// whether the flag applies to the state built so far, completed when nil
+	// or true
+	when func(*rule.State) bool
+
+	set0 func(*rule.State)
+	set1 func(*rule.State, string)
+}
+
+// Completion of a flag value.
+type Completer struct {
+	Kind string
+	// words completed by COMPLETE_WORDS
+	Words []string
+	// pattern of the files completed by COMPLETE_FILES
+	Glob string
+	// words completed after the = or : separator of the value
+	Values []string
+}
+
+const (
 	// keep-sorted start
-	"af":  "autofix",
-	"c":   "config",
-	"e":   "eval",
-	"f":   "format",
-	"fm":  "focus-metavariable",
-	"fr":  "fix-regex",
-	"fx":  "fix",
-	"i":   "path",
-	"l":   "language",
-	"m":   "message",
-	"mp":  "metavariable-pattern",
-	"mr":  "metavariable-regex",
-	"p":   "pattern",
-	"pe":  "pattern-either",
-	"pi":  "pattern-inside",
-	"pn":  "pattern-not",
-	"pni": "pattern-not-inside",
-	"pnr": "pattern-not-regex",
-	"pr":  "pattern-regex",
-	"ps":  "patterns",
-	"psk": "pattern-sinks",
-	"pso": "pattern-sources",
-	"sv":  "severity",
+	COMPLETE_FILES             = "files"
+	COMPLETE_METAVARIABLES     = "metavariables"
+	COMPLETE_METAVARIABLE_KEYS = "metavariable-keys"
+	COMPLETE_METAVARIABLE_REFS = "metavariable-refs"
+	COMPLETE_NONE              = ""
+	COMPLETE_OPTIONS           = "options"
+	COMPLETE_PATTERN           = "pattern"
+	COMPLETE_WORDS             = "words"
 	// keep-sorted end
+)
+
+const (
+	GROUP_PATTERN      = "Pattern options"
+	GROUP_PATTERN_LIST = "Pattern group options"
+	GROUP_TAINT        = "Taint options"
+	GROUP_SEARCH       = "Search options"
+	GROUP_RULE         = "Rule options"
+	GROUP_JOIN         = "Join options"
+	GROUP_EXTRACT      = "Extract options"
+	GROUP_RUN          = "Run options"
+	GROUP_OTHER        = "Other"
+	GROUP_COMPLETION   = "Shell completion"
+)
+
+// Help sections in order.
+var groups = []string{
+	GROUP_PATTERN,
+	GROUP_PATTERN_LIST,
+	GROUP_TAINT,
+	GROUP_SEARCH,
+	GROUP_RULE,
+	GROUP_JOIN,
+	GROUP_EXTRACT,
+	GROUP_RUN,
+	GROUP_OTHER,
+	GROUP_COMPLETION,
 }
 
-// Flags not expecting a value
-var flags0 = map[string]func(*rule.State){
-	// keep-sorted start block=yes
-	"autofix":         func(s *rule.State) { s.Autofix() },
-	"debug":           func(s *rule.State) { s.Debug() },
-	"export":          func(s *rule.State) { s.Export() },
-	"pattern-either":  func(s *rule.State) { s.PatternEither() },
-	"pattern-sinks":   func(s *rule.State) { s.PatternSinks() },
-	"pattern-sources": func(s *rule.State) { s.PatternSources() },
-	"patterns":        func(s *rule.State) { s.Patterns() },
-	"pop":             func(s *rule.State) { s.Pop() },
-	"rule":            func(s *rule.State) { s.Rule() },
-	"semgrep":         func(s *rule.State) { s.Command("semgrep") },
-	"verbose":         func(s *rule.State) { s.Verbose() },
+// Common languages completed for language values.
+var languages = []string{
+	// keep-sorted start
+	"bash",
+	"c",
+	"cpp",
+	"csharp",
+	"dockerfile",
+	"generic",
+	"go",
+	"java",
+	"javascript",
+	"json",
+	"php",
+	"python",
+	"ruby",
+	"rust",
+	"scala",
+	"terraform",
+	"typescript",
+	"yaml",
 	// keep-sorted end
 }
 
-// Flags expecting a value
-var flags1 = map[string]func(*rule.State, string){
-	// keep-sorted start block=yes
-	"config":               func(s *rule.State, v string) { s.Config(v) },
-	"eval":                 func(s *rule.State, v string) { s.Eval(v) },
-	"fix":                  func(s *rule.State, v string) { s.Fix(v) },
-	"fix-regex":            func(s *rule.State, v string) { s.FixRegex(v) },
-	"focus-metavariable":   func(s *rule.State, v string) { s.FocusMetavariable(v) },
-	"format":               func(s *rule.State, v string) { s.Format(v) },
-	"id":                   func(s *rule.State, v string) { s.ID(v) },
-	"language":             func(s *rule.State, v string) { s.Language(v) },
-	"message":              func(s *rule.State, v string) { s.Message(v) },
-	"metadata":             kv(func(s *rule.State, k string, v string) { s.Metadata(k, v) }),
-	"metavariable-pattern": func(s *rule.State, v string) { s.MetavariablePattern(v) },
-	"metavariable-regex":   kv(func(s *rule.State, k string, v string) { s.MetavariableRegex(k, v) }),
-	"option":               kv(func(s *rule.State, k string, v string) { s.Option(k, v) }),
-	"path":                 func(s *rule.State, v string) { s.Path(v) },
-	"path-exclude":         func(s *rule.State, v string) { s.PathExclude(v) },
-	"path-include":         func(s *rule.State, v string) { s.PathInclude(v) },
-	"pattern":              func(s *rule.State, v string) { s.Pattern(v) },
-	"pattern-inside":       func(s *rule.State, v string) { s.PatternInside(v) },
-	"pattern-not":          func(s *rule.State, v string) { s.PatternNot(v) },
-	"pattern-not-inside":   func(s *rule.State, v string) { s.PatternNotInside(v) },
-	"pattern-not-regex":    func(s *rule.State, v string) { s.PatternNotRegex(v) },
-	"pattern-regex":        func(s *rule.State, v string) { s.PatternRegex(v) },
-	"severity":             func(s *rule.State, v string) { s.Severity(v) },
+var (
+	completeFiles        = Completer{Kind: COMPLETE_FILES}
+	completePattern      = Completer{Kind: COMPLETE_PATTERN}
+	completeLanguages    = Completer{Kind: COMPLETE_WORDS, Words: languages}
+	completeMetavariable = Completer{Kind: COMPLETE_METAVARIABLES}
+	completeMetavarKey   = Completer{Kind: COMPLETE_METAVARIABLE_KEYS}
+	completeBool         = Completer{Kind: COMPLETE_WORDS, Words: []string{"true", "false"}}
+)
 
-	// keep-sorted end
+var Flags = []Flag{
+	// Pattern options
+	{Name: "language", Shortcut: "l", Arity: 1, Group: GROUP_PATTERN, Value: "language", Description: "Add a language to the rule (default: generic)",
+		Complete: completeLanguages, set1: func(s *rule.State, v string) { s.Language(v) }},
+	{Name: "pattern", Shortcut: "p", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern to match",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.Pattern(v) }},
+	{Name: "pattern-not", Shortcut: "pn", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern the match must not match",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.PatternNot(v) }},
+	{Name: "pattern-inside", Shortcut: "pi", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern to match inside the matched pattern",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.PatternInside(v) }},
+	{Name: "pattern-not-inside", Shortcut: "pni", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern to match not inside the matched pattern",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.PatternNotInside(v) }},
+	{Name: "pattern-regex", Shortcut: "pr", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern to match using a regex",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.PatternRegex(v) }},
+	{Name: "pattern-not-regex", Shortcut: "pnr", Arity: 1, Group: GROUP_PATTERN, Value: "pattern", Description: "Pattern to match not using a regex",
+		Complete: completePattern, when: inPatternGroup, set1: func(s *rule.State, v string) { s.PatternNotRegex(v) }},
+	{Name: "metavariable-regex", Shortcut: "mr", Arity: 1, Group: GROUP_PATTERN, Value: "name=regex", Description: "Metavariable to match using a regex",
+		Complete: completeMetavarKey, when: inPatternGroup, set1: kv(func(s *rule.State, k string, v string) { s.MetavariableRegex(k, v) })},
+	{Name: "metavariable-analysis", Shortcut: "ma", Arity: 1, Group: GROUP_PATTERN, Value: "name=kind", Description: "Analyze a metavariable (entropy, redos)",
+		Complete: Completer{Kind: COMPLETE_METAVARIABLE_KEYS, Values: []string{rule.ANALYZER_ENTROPY, rule.ANALYZER_REDOS}},
+		when:     inPatternGroup, set1: kv(func(s *rule.State, k string, v string) { s.MetavariableAnalysis(k, v) })},
+	{Name: "metavariable-comparison", Shortcut: "mc", Arity: 1, Group: GROUP_PATTERN, Value: "expr", Description: "Compare metavariables using an expression",
+		Complete: Completer{Kind: COMPLETE_METAVARIABLE_REFS}, when: inPatternGroup, set1: func(s *rule.State, v string) { s.MetavariableComparison(v) }},
+	{Name: "comparison-metavariable", Arity: 1, Group: GROUP_PATTERN, Value: "name", Description: "Metavariable whose content the last comparison evaluates",
+		Complete: completeMetavariable, when: inComparison, set1: func(s *rule.State, v string) { s.ComparisonMetavariable(v) }},
+	{Name: "comparison-base", Arity: 1, Group: GROUP_PATTERN, Value: "base", Description: "Base of the integers in the last comparison",
+		when: inComparison, set1: func(s *rule.State, v string) { s.ComparisonBase(v) }},
+	{Name: "comparison-strip", Group: GROUP_PATTERN, Description: "Strip the quotes of the metavariable in the last comparison",
+		when: inComparison, set0: func(s *rule.State) { s.ComparisonStrip() }},
+	{Name: "metavariable-type", Shortcut: "mt", Arity: 1, Group: GROUP_PATTERN, Value: "name=type", Description: "Metavariable to match by type",
+		Complete: completeMetavarKey, when: inPatternGroup, set1: kv(func(s *rule.State, k string, v string) { s.MetavariableType(k, v) })},
+	{Name: "metavariable-name", Shortcut: "mn", Arity: 1, Group: GROUP_PATTERN, Value: "name=module", Description: "Metavariable to match by the module it resolves to",
+		Complete: completeMetavarKey, when: inPatternGroup, set1: kv(func(s *rule.State, k string, v string) { s.MetavariableName(k, v) })},
+	{Name: "metavariable-pattern-regex", Shortcut: "mpr", Arity: 1, Group: GROUP_PATTERN, Value: "name=regex", Description: "Metavariable content to match using a regex",
+		Complete: completeMetavarKey, when: inPatternGroup, set1: kv(func(s *rule.State, k string, v string) { s.MetavariablePatternRegex(k, v) })},
+	{Name: "focus-metavariable", Shortcut: "fm", Arity: 1, Group: GROUP_PATTERN, Value: "name", Description: "Metavariable name to focus on",
+		Complete: completeMetavariable, when: inPatternGroup, set1: func(s *rule.State, v string) { s.FocusMetavariable(v) }},
+	{Name: "query", Shortcut: "q", Arity: 1, Group: GROUP_PATTERN, Value: "query|file.sq", Description: "Add the patterns of a query (see: Query syntax)",
+		Complete: Completer{Kind: COMPLETE_FILES, Glob: "*.sq"}, when: inPatternGroup, set1: applyQuery},
+
+	// Pattern group options
+	{Name: "patterns", Shortcut: "ps", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Start a pattern group where all patterns must match",
+		Brackets: true, when: inPatternGroup, set0: func(s *rule.State) { s.Patterns() }},
+	{Name: "pattern-either", Shortcut: "pe", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Start a pattern group where any pattern may match",
+		Brackets: true, when: inPatternGroup, set0: func(s *rule.State) { s.PatternEither() }},
+	{Name: "metavariable-pattern", Shortcut: "mp", Arity: 1, Group: GROUP_PATTERN_LIST, Value: "name", Description: "Start a pattern group to match a metavariable (name:language to match another language)",
+		Complete: Completer{Kind: COMPLETE_METAVARIABLES, Values: languages}, Brackets: true,
+		when: inPatternGroup, set1: cut(":", func(s *rule.State, k string, v string) { s.MetavariablePatternWithLanguage(k, v) })},
+	{Name: "pattern-sinks", Shortcut: "psk", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Set the pattern sinks for the current rule",
+		Brackets: true, set0: func(s *rule.State) { s.PatternSinks() }},
+	{Name: "pattern-sources", Shortcut: "pso", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Set the pattern sources for the current rule",
+		Brackets: true, set0: func(s *rule.State) { s.PatternSources() }},
+	{Name: "pattern-sanitizers", Shortcut: "psa", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Set the pattern sanitizers for the current rule",
+		Brackets: true, set0: func(s *rule.State) { s.PatternSanitizers() }},
+	{Name: "pattern-propagators", Shortcut: "ppr", Group: GROUP_PATTERN_LIST, Value: "...", Description: "Add a pattern propagator group to the current rule",
+		Brackets: true, set0: func(s *rule.State) { s.PatternPropagators() }},
+	{Name: "propagate-from", Arity: 1, Group: GROUP_PATTERN_LIST, Value: "name", Description: "Metavariable the current propagator group propagates from",
+		Complete: completeMetavariable, when: inPropagator, set1: func(s *rule.State, v string) { s.PropagateFrom(v) }},
+	{Name: "propagate-to", Arity: 1, Group: GROUP_PATTERN_LIST, Value: "name", Description: "Metavariable the current propagator group propagates to",
+		Complete: completeMetavariable, when: inPropagator, set1: func(s *rule.State, v string) { s.PropagateTo(v) }},
+	{Name: "pop", Shortcut: "^", Group: GROUP_PATTERN_LIST, Description: "Exit the current pattern group",
+		when: inNestedGroup, set0: func(s *rule.State) { s.Pop() }},
+
+	// Taint options
+	{Name: "label", Arity: 1, Group: GROUP_TAINT, Value: "label", Description: "Label the current taint source group",
+		when: inTaint(rule.TAINT_SOURCES), set1: func(s *rule.State, v string) { s.Label(v) }},
+	{Name: "requires", Arity: 1, Group: GROUP_TAINT, Value: "expr", Description: "Labels required by the current taint source or sink group",
+		when: inTaint(rule.TAINT_SOURCES, rule.TAINT_SINKS), set1: func(s *rule.State, v string) { s.Requires(v) }},
+	{Name: "by-side-effect", Arity: 1, Group: GROUP_TAINT, Value: "true|false|only", Description: "Taint by side effect in the current source or sanitizer group",
+		Complete: Completer{Kind: COMPLETE_WORDS, Words: []string{"true", "false", "only"}}, when: inTaint(rule.TAINT_SOURCES, rule.TAINT_SANITIZERS), set1: func(s *rule.State, v string) { s.BySideEffect(v) }},
+	{Name: "exact", Arity: 1, Group: GROUP_TAINT, Value: "true|false", Description: "Only match the exact expression in the current taint group",
+		Complete: completeBool, when: inTaint(rule.TAINT_SOURCES, rule.TAINT_SINKS, rule.TAINT_SANITIZERS), set1: func(s *rule.State, v string) { s.Exact(v) }},
+	{Name: "control", Group: GROUP_TAINT, Description: "Mark the current taint source group as a control source",
+		when: inTaint(rule.TAINT_SOURCES), set0: func(s *rule.State) { s.Control() }},
+
+	// Search options
+	{Name: "path", Shortcut: "i", Arity: 1, Group: GROUP_SEARCH, Value: "path", Description: "Add the path to the search",
+		Complete: completeFiles, set1: func(s *rule.State, v string) { s.Path(v) }},
+	{Name: "eval", Shortcut: "e", Arity: 1, Group: GROUP_SEARCH, Value: "string", Description: "Evaluate the rule on the given string",
+		set1: func(s *rule.State, v string) { s.Eval(v) }},
+
+	// Rule options
+	{Name: "message", Shortcut: "m", Arity: 1, Group: GROUP_RULE, Value: "message", Description: "Message to display",
+		set1: func(s *rule.State, v string) { s.Message(v) }},
+	{Name: "fix", Shortcut: "fx", Arity: 1, Group: GROUP_RULE, Value: "pattern", Description: "Fix pattern",
+		set1: func(s *rule.State, v string) { s.Fix(v) }},
+	{Name: "fix-regex", Shortcut: "fr", Arity: 1, Group: GROUP_RULE, Value: "regex", Description: "Fix pattern using a regex",
+		set1: func(s *rule.State, v string) { s.FixRegex(v) }},
+	{Name: "autofix", Shortcut: "af", Group: GROUP_RULE, Description: "Automatically write fixes",
+		set0: func(s *rule.State) { s.Autofix() }},
+	{Name: "id", Arity: 1, Group: GROUP_RULE, Value: "id", Description: "Rule ID",
+		set1: func(s *rule.State, v string) { s.ID(v) }},
+	{Name: "metadata", Arity: 1, Group: GROUP_RULE, Value: "key=value", Description: "Add metadata to the rule (dotted keys nest, repeated keys make lists)",
+		set1: kv(func(s *rule.State, k string, v string) { s.Metadata(k, v) })},
+	{Name: "metadata-json", Arity: 1, Group: GROUP_RULE, Value: "key=value", Description: "Add metadata parsed as JSON or YAML to the rule",
+		set1: kv(func(s *rule.State, k string, v string) { s.MetadataValue(k, v) })},
+	{Name: "severity", Shortcut: "sv", Arity: 1, Group: GROUP_RULE, Value: "severity", Description: "Set the severity of the rule",
+		Complete: Completer{Kind: COMPLETE_WORDS, Words: []string{rule.SEVERITY_INFO, rule.SEVERITY_WARNING, rule.SEVERITY_ERROR}},
+		set1:     func(s *rule.State, v string) { s.Severity(v) }},
+	{Name: "option", Arity: 1, Group: GROUP_RULE, Value: "key=value", Description: "Set an option for the rule (see: --list-options)",
+		Complete: Completer{Kind: COMPLETE_OPTIONS}, set1: kv(func(s *rule.State, k string, v string) { s.Option(k, v) })},
+	{Name: "min-version", Arity: 1, Group: GROUP_RULE, Value: "version", Description: "Minimum engine version of the rule (default: from the features it uses on export with Semgrep)",
+		set1: func(s *rule.State, v string) { s.MinVersion(v) }},
+	{Name: "max-version", Arity: 1, Group: GROUP_RULE, Value: "version", Description: "Maximum engine version of the rule",
+		set1: func(s *rule.State, v string) { s.MaxVersion(v) }},
+	{Name: "path-include", Arity: 1, Group: GROUP_RULE, Value: "path", Description: "Limit the search to the specified path",
+		Complete: completeFiles, set1: func(s *rule.State, v string) { s.PathInclude(v) }},
+	{Name: "path-exclude", Arity: 1, Group: GROUP_RULE, Value: "path", Description: "Exclude the specified path from the search",
+		Complete: completeFiles, set1: func(s *rule.State, v string) { s.PathExclude(v) }},
+	{Name: "rule", Group: GROUP_RULE, Description: "Start a new rule",
+		set0: func(s *rule.State) { s.Rule() }},
+	{Name: "from", Arity: 1, Group: GROUP_RULE, Value: "rules.yaml", Description: "Load the rules of a file, the following options modify the last one",
+		Complete: completeFiles, set1: func(s *rule.State, v string) { s.Load(v) }},
+
+	// Join options
+	{Name: "join", Group: GROUP_JOIN, Description: "Start a join rule combining the previous rules",
+		set0: func(s *rule.State) { s.Join() }},
+	{Name: "on", Arity: 1, Group: GROUP_JOIN, Value: "condition", Description: "Join condition on rule metavariables (such as: a.$X == b.$X)",
+		when: inJoin, set1: func(s *rule.State, v string) { s.On(v) }},
+	{Name: "join-ref", Arity: 1, Group: GROUP_JOIN, Value: "[alias=]path", Description: "Add a rule file to the current join rule",
+		Complete: completeFiles, when: inJoin, set1: joinRef},
+
+	// Extract options
+	{Name: "extract", Arity: 1, Group: GROUP_EXTRACT, Value: "name", Description: "Extract the metavariable content to search it with the following rules",
+		Complete: completeMetavariable, set1: func(s *rule.State, v string) { s.Extract(v) }},
+	{Name: "dest-language", Arity: 1, Group: GROUP_EXTRACT, Value: "language", Description: "Language of the extracted content",
+		Complete: completeLanguages, set1: func(s *rule.State, v string) { s.DestLanguage(v) }},
+	{Name: "dest-rules", Arity: 1, Group: GROUP_EXTRACT, Value: "id", Description: "Only run the rule on the extracted content, repeat for more rules",
+		set1: func(s *rule.State, v string) { s.DestRules(v) }},
+	{Name: "transform", Arity: 1, Group: GROUP_EXTRACT, Value: "transform", Description: "Transform the extracted content (unquote_string, concat_json_string_array)",
+		Complete: Completer{Kind: COMPLETE_WORDS, Words: []string{"unquote_string", "concat_json_string_array"}},
+		set1:     func(s *rule.State, v string) { s.Transform(v) }},
+	{Name: "reduce", Arity: 1, Group: GROUP_EXTRACT, Value: "reduce", Description: "Combine the extracted content of a file (concat, separate)",
+		Complete: Completer{Kind: COMPLETE_WORDS, Words: []string{rule.REDUCE_CONCAT, rule.REDUCE_SEPARATE}},
+		set1:     func(s *rule.State, v string) { s.Reduce(v) }},
+
+	// Run options
+	{Name: "format", Shortcut: "f", Arity: 1, Group: GROUP_RUN, Value: "format", Description: "Output format (" + strings.Join(formats(), ", ") + ")",
+		Complete: Completer{Kind: COMPLETE_WORDS, Words: formats()}, set1: func(s *rule.State, v string) { s.Format(v) }},
+	{Name: "config", Shortcut: "c", Arity: 1, Group: GROUP_RUN, Value: "config", Description: "Add additional rules",
+		Complete: completeFiles, set1: func(s *rule.State, v string) { s.Config(v) }},
+	{Name: "semgrep", Group: GROUP_RUN, Description: "Run Semgrep instead of Opengrep",
+		set0: func(s *rule.State) { s.Command("semgrep") }},
+	{Name: "debug", Group: GROUP_RUN, Description: "Output semsearch debug information",
+		set0: func(s *rule.State) { s.Debug() }},
+	{Name: "strict", Group: GROUP_RUN, Description: "Exit with an error when there are warnings",
+		set0: func(s *rule.State) { s.Strict() }},
+	{Name: "verbose", Group: GROUP_RUN, Description: "Enable Opengrep verbose mode",
+		set0: func(s *rule.State) { s.Verbose() }},
+	{Name: "export", Group: GROUP_RUN, Description: "Output the rule instead of running Opengrep",
+		set0: func(s *rule.State) { s.Export() }},
+
+	// Other
+	{Name: "list-options", Group: GROUP_OTHER, Description: "List the known rule options",
+		Standalone: true},
+	{Name: "print-config", Group: GROUP_OTHER, Description: "Print the defaults merged from the configuration files",
+		Standalone: true},
+	{Name: "to-cli", Arity: 1, Group: GROUP_OTHER, Value: "rules.yaml", Description: "Print the semsearch arguments rebuilding the rules of a file",
+		Complete: completeFiles, Standalone: true},
+
+	// Shell completion
+	{Name: "bash-completion", Group: GROUP_COMPLETION, Description: "Output bash completion script",
+		Standalone: true},
+	{Name: "zsh-completion", Group: GROUP_COMPLETION, Description: "Output zsh completion script",
+		Standalone: true},
+	{Name: "fish-completion", Group: GROUP_COMPLETION, Description: "Output fish completion script",
+		Standalone: true},
+	{Name: "powershell-completion", Group: GROUP_COMPLETION, Description: "Output PowerShell completion script",
+		Standalone: true},
 }
 
+// Lookup tables derived from Flags, used by the parser.
+var (
+	shortcuts = map[string]string{}
+	// Flags not expecting a value
+	flags0 = map[string]func(*rule.State){}
+	// Flags expecting a value
+	flags1 = map[string]func(*rule.State, string){}
+	// Flags starting a pattern group that a bracket can follow
+	groupFlags = map[string]bool{}
+)
+
 func init() {
-	flags0["^"] = flags0["pop"]
+	for _, format := range formats() {
+		Flags = append(Flags, Flag{
+			Name:        format,
+			Group:       GROUP_RUN,
+			Description: fmt.Sprintf("Same as --format %s", format),
+			set0:        func(s *rule.State) { s.Format(format) },
+		})
+	}
 
+	for _, flag := range Flags {
+		if flag.Standalone {
+			continue
+		}
+		switch flag.Arity {
+		case 0:
+			flags0[flag.Name] = flag.set0
+		case 1:
+			flags1[flag.Name] = flag.set1
+		}
+		switch flag.Shortcut {
+		case "":
+		case "^":
+			flags0["^"] = flag.set0
+		default:
+			shortcuts[flag.Shortcut] = flag.Name
+		}
+		groupFlags[flag.Name] = flag.Brackets
+	}
+}
+
+// Output formats accepted by --format, sorted.
+func formats() []string {
+	names := []string{}
 	for format := range rule.Formats {
-		flags0[format] = func(s *rule.State) { s.Format(format) }
+		names = append(names, format)
 	}
+	slices.Sort(names)
+	return names
+}
+
+// Whether the flag is an output format shortcut such as --json.
+func (f Flag) format() bool {
+	return rule.Formats[f.Name] && f.Arity == 0
 }
 
 func kv(f func(s *rule.State, k string, v string)) func(*rule.State, string) {
+	return cut("=", f)
+}
+
+func cut(sep string, f func(s *rule.State, k string, v string)) func(*rule.State, string) {
 	return func(s *rule.State, v string) {
-		k, v, _ := strings.Cut(v, "=")
+		k, v, _ := strings.Cut(v, sep)
 		f(s, k, v)
 	}
 }
+
+// Parse a join reference given as path or alias=path.
+func joinRef(s *rule.State, v string) {
+	if alias, path, ok := strings.Cut(v, "="); ok {
+		s.JoinRef(path, alias)
+	} else {
+		s.JoinRef(v, "")
+	}
+}
+
+// Add the patterns of a query, read from the file when given a .sq path.
+func applyQuery(s *rule.State, v string) {
+	var err error
+	if query.IsFile(v) {
+		err = query.ApplyFile(s, v)
+	} else {
+		err = query.Apply(s, v)
+	}
+	if err != nil {
+		s.Fail(fmt.Sprintf("invalid query: %s", err))
+	}
+}
+
+// Whether patterns can be added to a pattern group.
+func inPatternGroup(s *rule.State) bool {
+	return s.Depth() >= 0
+}
+
+// Whether a pattern group can be exited without leaving the top-level group.
+func inNestedGroup(s *rule.State) bool {
+	return s.Depth() > 0
+}
+
+func inPropagator(s *rule.State) bool {
+	return s.InPropagator()
+}
+
+func inComparison(s *rule.State) bool {
+	return s.InComparison()
+}
+
+func inJoin(s *rule.State) bool {
+	return s.InJoin()
+}
+
+// Whether the current taint group is in one of the sections.
+func inTaint(sections ...string) func(*rule.State) bool {
+	return func(s *rule.State) bool {
+		return slices.Contains(sections, s.TaintSection())
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -30,3 +31,59 @@ func TestAmbiguousShortcutsCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestFlagsInHelp(t *testing.T) {
+	help := Help()
+	for _, flag := range Flags {
+		if flag.format() {
+			continue
+		}
+		for _, word := range flag.words() {
+			if !strings.Contains(help, word+" ") {
+				t.Errorf("flag '%s' is missing from the help", word)
+			}
+		}
+	}
+}
+
+func TestFlagsInCompletion(t *testing.T) {
+	completion := Complete([]string{"-"}).String()
+	for _, flag := range Flags {
+		if flag.when != nil {
+			continue
+		}
+		for _, word := range flag.words() {
+			if !strings.Contains(completion, word+"\t") {
+				t.Errorf("flag '%s' is missing from the completion", word)
+			}
+		}
+	}
+	if formats := Complete([]string{"-f", ""}).String(); formats != "emacs\ngitlab-sast\ngitlab-secrets\njson\njunit-xml\nsarif\ntext\nvim\n" {
+		t.Errorf("formats of rule.Formats are not completed: %q", formats)
+	}
+}
+
+func TestShellCompletions(t *testing.T) {
+	scripts := map[string]string{
+		"bash":       GetBashCompletion(),
+		"zsh":        GetZshCompletion(),
+		"fish":       GetFishCompletion(),
+		"powershell": GetPowerShellCompletion(),
+	}
+	for shell, script := range scripts {
+		if !strings.Contains(script, "__complete") {
+			t.Errorf("%s completion does not call __complete", shell)
+		}
+	}
+}
+
+func TestFlagArity(t *testing.T) {
+	for _, flag := range Flags {
+		if flag.Standalone {
+			continue
+		}
+		if (flag.Arity == 0) != (flag.set0 != nil) || (flag.Arity == 1) != (flag.set1 != nil) {
+			t.Errorf("flag '%s' has arity %d but no matching setter", flag.Name, flag.Arity)
+		}
+	}
+}
@@ -1,55 +1,111 @@
 package cli
 
-import "strings"
-
-var help string = `Usage: semsearch [options]
-
-Pattern options:
-  -l    --language <language>               Add a language to the rule (default: generic)
-  -p    --pattern <pattern>                 Pattern to match
-  -pi   --pattern-inside <pattern>          Pattern to match inside the matched pattern
-  -pni  --pattern-not-inside <pattern>      Pattern to match not inside the matched pattern
-  -pr   --pattern-regex <pattern>           Pattern to match using a regex
-  -pnr  --pattern-not-regex <pattern>       Pattern to match not using a regex
-  -mr   --metavariable-regex <name=regex>   Metavariable to match using a regex
-  -fm   --focus-metavariable <name>         Metavariable name to focus on
-
-Pattern group options:
-  -ps   --patterns [...]                    Start a pattern group where all patterns must match
-  -pe   --pattern-either [...]              Start a pattern group where any pattern may match
-  -mp   --metavariable-pattern <name> [...] Start a pattern group to match a metavariable
-  -psk  --pattern-sinks [...]               Set the pattern sinks for the current rule
-  -pso  --pattern-sources [...]             Set the pattern sources for the current rule
-  ^     --pop                               Exit the current pattern group
-
-Search options:
-  -i    --path <path>                       Add the path to the search
-  -e    --eval <string>                     Evaluate the rule on the given string
-
-Rule options:
-  -m    --message <message>                 Message to display
-  -fx   --fix <pattern>                     Fix pattern
-  -fr   --fix-regex <regex>                 Fix pattern using a regex
-  -af   --autofix                           Automatically write fixes
-  --id  <id>                                Rule ID
-  --metadata <key=value>                    Add metadata to the rule
-  --severity <severity>                     Set the severity of the rule
-  --option <key=value>                      Set an option for the rule (such as: generic_ellipsis_max_span)
-  --path-include <path>                     Limit the search to the specified path
-  --path-exclude <path>                     Exclude the specified path from the search
-  --rule                                    Start a new rule
-
-Run options:
-  -f    --format <format>                   Output format (json, text, sarif, vim, emacs)
-  -c    --config <config>                   Add additional rules
-  --debug                                   Output semsearch debug information
-  --verbose                                 Enable Opengrep verbose mode
-  --export                                  Output the rule instead of running Opengrep
-
-Shell completion:
-  --bash-completion                         Output bash completion script
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/becojo/semsearch/pkg/rule"
+)
+
+var usage = `Usage: semsearch [command] [options] [-- paths...]
+
+Values can be given as a separate argument or joined with = (--format=json, -l=go).
+Values are read from a file with @path and from stdin with -, use @@ for a literal @.
+The arguments after -- are paths to search, like -i.
+Defaults are read from $XDG_CONFIG_HOME/semsearch/config.yaml and the .semsearch.yaml
+of the working directory or its parents (see: --print-config).
 `
 
+const GROUP_QUERY = "Query syntax"
+
+// Help lines following the flags of a section. The query syntax section has
+// no flags.
+var groupNotes = map[string][]string{
+	GROUP_PATTERN_LIST: {
+		helpLine("( )   [ ]", "Open and close the group started by the flag before them"),
+	},
+	GROUP_RUN: {
+		helpLine("--<format>", "Same as --format <format>"),
+	},
+	GROUP_QUERY: {
+		helpLine(`p"pattern"`, "Pattern (backquotes for a pattern without escapes)"),
+		helpLine("all(q, ...)   any(q, ...)", "Patterns that must all match, or any of which may match"),
+		helpLine(`inside(p"...")`, "Pattern to match inside"),
+		helpLine(`not p"..."  not inside(p"...")  not regex("...")`, ""),
+		helpLine(`regex("...")  regex($X, "...")`, "Regex on the content, or on a metavariable"),
+		helpLine(`focus($X)  compare("...")`, "Focus on, or compare metavariables"),
+		helpLine(`compare($X, "...", base(N), strip)`, "Compare the content of a metavariable"),
+		helpLine(`analysis($X, entropy)  type($X, "...")  name($X, "...")`, ""),
+		helpLine(`metavariable($X, ["language",] q, ...)`, "Patterns to match in a metavariable"),
+		helpLine(`metavariable($X, regex("..."))`, "Regex to match in the content of a metavariable"),
+		helpLine("# comment", "Comments run to the end of the line"),
+	},
+}
+
+// Generate the help from the commands and the flags.
 func Help() string {
-	return strings.TrimSpace(help)
+	var b strings.Builder
+	b.WriteString(usage)
+	b.WriteString(commandsHelp())
+	for _, group := range slices.Insert(slices.Clone(groups), slices.Index(groups, GROUP_RUN)+1, GROUP_QUERY) {
+		writeGroup(&b, group)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Write the help section of the flags of the group.
+func writeGroup(b *strings.Builder, group string) {
+	fmt.Fprintf(b, "\n%s:\n", group)
+	for _, flag := range Flags {
+		if flag.Group == group && !flag.format() {
+			b.WriteString(flag.help() + "\n")
+		}
+	}
+	for _, line := range groupNotes[group] {
+		b.WriteString(line + "\n")
+	}
+}
+
+// Help line of the flag, such as: -p    --pattern <pattern>    Pattern to match
+func (f Flag) help() string {
+	usage := "--" + f.Name
+	switch {
+	case f.Arity == 1 && f.Brackets:
+		usage += fmt.Sprintf(" <%s> [...]", f.Value)
+	case f.Arity == 1:
+		usage += fmt.Sprintf(" <%s>", f.Value)
+	case f.Value != "":
+		usage += fmt.Sprintf(" [%s]", f.Value)
+	}
+	switch f.Shortcut {
+	case "":
+	case "^":
+		usage = fmt.Sprintf("%-6s%s", "^", usage)
+	default:
+		usage = fmt.Sprintf("%-6s%s", "-"+f.Shortcut, usage)
+	}
+	return helpLine(usage, f.Description)
+}
+
+func helpLine(usage string, description string) string {
+	if description == "" {
+		return "  " + usage
+	}
+	return strings.TrimRight(fmt.Sprintf("  %-41s %s", usage, description), " ")
+}
+
+// OptionsHelp returns the list of known rule options
+func OptionsHelp() string {
+	var b strings.Builder
+	b.WriteString("Rule options (--option <key=value>):\n")
+	for _, option := range rule.Options {
+		usage := fmt.Sprintf("%s=<%s>", option.Name, option.Type)
+		description := option.Description
+		if option.Default != nil {
+			description += fmt.Sprintf(" (default: %v)", option.Default)
+		}
+		fmt.Fprintf(&b, "  %-50s %s\n", usage, description)
+	}
+	return strings.TrimSpace(b.String())
 }
@@ -2,46 +2,241 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/becojo/semsearch/pkg/rule"
 )
 
+// Reader of the flag values given as -.
+var Stdin io.Reader = os.Stdin
+
 func Parse(args []string) (*rule.State, error) {
-	var cmd string
-	var value string
-	state := rule.Builder().Rule()
+	return ParseWith(rule.Builder(), args)
+}
+
+// Parse the arguments on a state holding defaults, such as the defaults of a
+// configuration file.
+func ParseWith(state *rule.State, args []string) (*rule.State, error) {
+	p := newParser(state, Stdin)
+	if err := p.parse(args); err != nil {
+		return nil, err
+	}
+
+	if len(p.brackets) > 0 {
+		open := p.brackets[len(p.brackets)-1]
+		return nil, parseError(open.index, args[open.index], fmt.Sprintf("unclosed '%s'", args[open.index]), fmt.Sprintf("close it with '%s'", open.closing))
+	}
+
+	return p.state, nil
+}
+
+// State of the parsing of a command line. The state is kept when parsing
+// fails so completion can use the part before the error.
+type parser struct {
+	state *rule.State
+	// brackets still open
+	brackets []bracket
+	// whether the last flag started a group a bracket can follow
+	group bool
+
+	stdin     io.Reader
+	stdinRead bool
+}
+
+func newParser(state *rule.State, stdin io.Reader) *parser {
+	return &parser{
+		state: state.Rule(),
+		stdin: stdin,
+	}
+}
+
+func (p *parser) parse(args []string) error {
+	state := p.state
 
 	for i := 0; i < len(args); i++ {
-		cmd = normalizeShortcut(args[i])
-		if cmd == "" {
-			return nil, fmt.Errorf("invalid command: %s", args[i])
+		state.At(i, args[i])
+
+		if closing, ok := closingBrackets[args[i]]; ok {
+			if !p.group {
+				return parseError(i, args[i], fmt.Sprintf("'%s' does not follow a group flag", args[i]), "put it right after -ps, -pe, -mp or a taint group flag")
+			}
+			p.brackets = append(p.brackets, bracket{index: i, closing: closing, depth: state.Depth()})
+			p.group = false
+			continue
+		}
+		p.group = false
+
+		if args[i] == ")" || args[i] == "]" {
+			if len(p.brackets) == 0 {
+				return parseError(i, args[i], fmt.Sprintf("unmatched '%s'", args[i]), "")
+			}
+			open := p.brackets[len(p.brackets)-1]
+			if open.closing != args[i] {
+				return parseError(i, args[i], fmt.Sprintf("'%s' does not match '%s' of argument %d", args[i], args[open.index], open.index+1), fmt.Sprintf("close it with '%s'", open.closing))
+			}
+			p.brackets = p.brackets[:len(p.brackets)-1]
+			for depth := state.Depth(); depth >= open.depth; depth-- {
+				state.Pop()
+			}
+			continue
+		}
+
+		// everything after -- is a path to search
+		if args[i] == "--" {
+			for j := i + 1; j < len(args); j++ {
+				state.At(j, args[j]).Path(args[j])
+			}
+			break
+		}
+
+		flag, value, hasValue := args[i], "", false
+		if strings.HasPrefix(flag, "-") {
+			flag, value, hasValue = strings.Cut(flag, "=")
+		}
+
+		cmd := normalizeShortcut(flag)
+		if cmd == "" && !strings.HasPrefix(flag, "-") {
+			return parseError(i, args[i], fmt.Sprintf("invalid argument '%s'", args[i]), "flags start with - or --")
 		}
 
 		if f, ok := flags0[cmd]; ok {
+			if hasValue {
+				return parseError(i, args[i], fmt.Sprintf("flag '%s' does not take a value", flag), fmt.Sprintf("use %s without =%s", flag, value))
+			}
 			f(state)
+			p.group = groupFlags[cmd]
+			if err := p.checkBrackets(args, i); err != nil {
+				return err
+			}
 			continue
 		}
 
 		f, ok := flags1[cmd]
 		if !ok {
-			return nil, fmt.Errorf("unknown command %s", cmd)
+			hint := ""
+			if closest := rule.Closest(flag, flagNames()); closest != "" {
+				hint = fmt.Sprintf("did you mean %s?", closest)
+			}
+			return parseError(i, args[i], fmt.Sprintf("unknown flag '%s'", flag), hint)
 		}
 
-		i += 1
-		if i < len(args) {
+		if !hasValue {
+			if i+1 >= len(args) {
+				return parseError(i, args[i], fmt.Sprintf("missing value for '%s'", flag), "")
+			}
+			i += 1
 			value = args[i]
 		}
 
-		f(state, value)
+		content, err := p.readValue(value)
+		if err != nil {
+			hint := ""
+			if strings.HasPrefix(value, "@") {
+				hint = "use @@ for a value starting with @"
+			}
+			return parseError(i, args[i], err.Error(), hint)
+		}
+
+		f(state, content)
+		p.group = groupFlags[cmd]
+		if err := p.checkBrackets(args, i); err != nil {
+			return err
+		}
 	}
 
-	return state, nil
+	return nil
+}
+
+// Group opened with a bracket on the command line.
+type bracket struct {
+	// index of the opening bracket
+	index int
+	// expected closing bracket
+	closing string
+	// depth of the group opened by the bracket
+	depth int
+}
+
+var closingBrackets = map[string]string{
+	"(": ")",
+	"[": "]",
+}
+
+// Report a flag closing the group of an open bracket, such as a ^ too many.
+func (p *parser) checkBrackets(args []string, index int) error {
+	if len(p.brackets) == 0 {
+		return nil
+	}
+	open := p.brackets[len(p.brackets)-1]
+	if p.state.Depth() >= open.depth {
+		return nil
+	}
+	return parseError(index, args[index], fmt.Sprintf("'%s' leaves the group opened by '%s' at argument %d", args[index], args[open.index], open.index+1), fmt.Sprintf("close the group with '%s' first", open.closing))
+}
+
+// Read a flag value from a file when given as @path, or from stdin when given
+// as -. The trailing newline of the content is removed.
+func (p *parser) readValue(value string) (string, error) {
+	var content []byte
+	var err error
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case value == "-":
+		if p.stdinRead {
+			return "", fmt.Errorf("stdin can only be read once")
+		}
+		p.stdinRead = true
+		content, err = io.ReadAll(p.stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %w", err)
+		}
+	case strings.HasPrefix(value, "@"):
+		content, err = os.ReadFile(value[1:])
+		if err != nil {
+			return "", fmt.Errorf("failed to read value: %w", err)
+		}
+	default:
+		return value, nil
+	}
+	value = strings.TrimSuffix(string(content), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+func parseError(index int, flag string, message string, hint string) *rule.Diagnostic {
+	return &rule.Diagnostic{
+		Origin:   rule.Origin{Index: index, Flag: flag},
+		Severity: rule.DIAGNOSTIC_ERROR,
+		Message:  message,
+		Hint:     hint,
+	}
+}
+
+// Names of all flags as written on the command line.
+func flagNames() []string {
+	names := []string{}
+	for short := range shortcuts {
+		names = append(names, "-"+short)
+	}
+	for name := range flags0 {
+		names = append(names, "--"+name)
+	}
+	for name := range flags1 {
+		names = append(names, "--"+name)
+	}
+	slices.Sort(names)
+	return names
 }
 
 func normalizeShortcut(arg string) (cmd string) {
 	if len(arg) > 2 && arg[0:2] == "--" {
 		cmd = arg[2:]
-	} else if arg[0] == '-' {
+	} else if arg == "^" {
+		cmd = arg
+	} else if len(arg) > 0 && arg[0] == '-' {
 		cmd = shortcuts[arg[1:]]
 	}
 	return
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/becojo/semsearch/pkg/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		args    []string
+		index   int
+		message string
+		hint    string
+	}{
+		{[]string{"-p", "foo", "--pattern-insde", "x"}, 2, "unknown flag '--pattern-insde'", "did you mean --pattern-inside?"},
+		{[]string{"-p", "foo", "-zzzzzz"}, 2, "unknown flag '-zzzzzz'", ""},
+		{[]string{"-p", "foo", "bar"}, 2, "invalid argument 'bar'", "flags start with - or --"},
+		{[]string{"-p", "foo", "-pi"}, 2, "missing value for '-pi'", ""},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.args)
+		var d *rule.Diagnostic
+		require.True(t, errors.As(err, &d), test.args)
+		assert.Equal(t, test.index, d.Index)
+		assert.Equal(t, test.args[test.index], d.Flag)
+		assert.Equal(t, rule.DIAGNOSTIC_ERROR, d.Severity)
+		assert.Equal(t, test.message, d.Message)
+		assert.Equal(t, test.hint, d.Hint)
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	state, err := Parse([]string{"-p", "foo", "-sv", "bad"})
+	require.NoError(t, err)
+	assert.NoError(t, state.Err())
+	require.Len(t, state.Warnings(), 1)
+	assert.Equal(t, "-sv", state.Warnings()[0].Flag)
+
+	state, err = Parse([]string{"--strict", "-p", "foo", "-sv", "bad"})
+	require.NoError(t, err)
+	assert.Error(t, state.Err())
+}
+
+func TestFormatDiagnostic(t *testing.T) {
+	args := []string{"-p", "foo($X)", "--pattern-insde", "x"}
+	_, err := Parse(args)
+	var d *rule.Diagnostic
+	require.True(t, errors.As(err, &d))
+
+	expected := `error: unknown flag '--pattern-insde'
+  semsearch -p 'foo($X)' --pattern-insde x
+                         ^^^^^^^^^^^^^^^
+hint: did you mean --pattern-inside?`
+	assert.Equal(t, expected, FormatDiagnostic(args, d))
+
+	expected = `error: unknown flag '--pattern-insde'
+  semsearch lint -p 'foo($X)' --pattern-insde x
+                              ^^^^^^^^^^^^^^^
+hint: did you mean --pattern-inside?`
+	assert.Equal(t, expected, FormatCommandDiagnostic(append([]string{"lint"}, args...), args, d))
+	assert.Equal(t, 2, d.Index)
+}
+
+func TestParseJoinedValues(t *testing.T) {
+	joined, err := Parse([]string{"--format=json", "-l=go", "-p=foo($X)", "--metadata=a=b", "--export"})
+	require.NoError(t, err)
+	separate, err := Parse([]string{"--format", "json", "-l", "go", "-p", "foo($X)", "--metadata", "a=b", "--export"})
+	require.NoError(t, err)
+
+	expected, err := separate.MarshalRules()
+	require.NoError(t, err)
+	actual, err := joined.MarshalRules()
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	_, err = Parse([]string{"-p", "foo", "--export=yes"})
+	var d *rule.Diagnostic
+	require.True(t, errors.As(err, &d))
+	assert.Equal(t, "flag '--export' does not take a value", d.Message)
+}
+
+func TestParsePathSeparator(t *testing.T) {
+	state, err := Parse([]string{"-p", "foo", "-i", "a/", "--", "src/", "-p", "--"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/", "src/", "-p", "--"}, state.Paths())
+}
+
+func TestParseValueFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pattern.txt")
+	require.NoError(t, os.WriteFile(path, []byte("foo(\n  $X)\n"), 0644))
+	Stdin = strings.NewReader("bar($Y)\n")
+	defer func() { Stdin = os.Stdin }()
+
+	state, err := Parse([]string{"-p", "@" + path, "-pn", "-", "-m", "@@user", "--export"})
+	require.NoError(t, err)
+	rules, err := state.MarshalRules()
+	require.NoError(t, err)
+	assert.Contains(t, string(rules), "pattern: |-\n      foo(\n        $X)")
+	assert.Contains(t, string(rules), "pattern-not: bar($Y)")
+	assert.Contains(t, string(rules), "message: '@user'")
+
+	_, err = Parse([]string{"-p", "-", "-pn", "-"})
+	var d *rule.Diagnostic
+	require.True(t, errors.As(err, &d))
+	assert.Equal(t, 3, d.Index)
+	assert.Equal(t, "stdin can only be read once", d.Message)
+
+	_, err = Parse([]string{"-m", "@missing.txt"})
+	require.True(t, errors.As(err, &d))
+	assert.Equal(t, "use @@ for a value starting with @", d.Hint)
+}
+
+func TestParseBrackets(t *testing.T) {
+	brackets, err := Parse([]string{"-ps", "(", "-p", "a", "-pe", "[", "-p", "b", "-p", "c", "]", "-p", "d", ")", "-pn", "e"})
+	require.NoError(t, err)
+	pops, err := Parse([]string{"-ps", "-p", "a", "-pe", "-p", "b", "-p", "c", "^", "-p", "d", "^", "-pn", "e"})
+	require.NoError(t, err)
+
+	expected, err := pops.MarshalRules()
+	require.NoError(t, err)
+	actual, err := brackets.MarshalRules()
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+	assert.Equal(t, 0, brackets.Depth())
+}
+
+func TestParseUnbalancedBrackets(t *testing.T) {
+	tests := []struct {
+		args    []string
+		index   int
+		message string
+	}{
+		{[]string{"-p", "a", "("}, 2, "'(' does not follow a group flag"},
+		{[]string{"-p", "a", ")"}, 2, "unmatched ')'"},
+		{[]string{"-ps", "(", "-p", "a", "]"}, 4, "']' does not match '(' of argument 2"},
+		{[]string{"-ps", "(", "-pe", "[", "-p", "a", "]"}, 1, "unclosed '('"},
+		{[]string{"-ps", "(", "-p", "a", "^", ")"}, 4, "'^' leaves the group opened by '(' at argument 2"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.args)
+		var d *rule.Diagnostic
+		require.True(t, errors.As(err, &d), test.args)
+		assert.Equal(t, test.index, d.Index, test.args)
+		assert.Equal(t, test.message, d.Message)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	query, err := Parse([]string{"-l", "go", "-q", `all(p"foo($X)", not inside(p"try { ... }"), regex($X, "^a"))`})
+	require.NoError(t, err)
+	flags, err := Parse([]string{"-l", "go", "-p", "foo($X)", "-pni", "try { ... }", "-mr", "X=^a"})
+	require.NoError(t, err)
+
+	expected, err := flags.MarshalRules()
+	require.NoError(t, err)
+	actual, err := query.MarshalRules()
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	state, err := Parse([]string{"-q", `all(p"foo"`})
+	require.NoError(t, err)
+	assert.EqualError(t, state.Err(), "rule-1: invalid query: 1:11: expected ')', found end of query (argument 1: -q)")
+}
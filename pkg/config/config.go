@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/becojo/semsearch/pkg/rule"
+	"go.yaml.in/yaml/v2"
+)
+
+// Name of the project configuration file, found in the working directory or
+// one of its parents.
+const PROJECT_FILE = ".semsearch.yaml"
+
+// Defaults applied before the command line. The project configuration
+// overrides the values of the user configuration and adds to its lists.
+type Config struct {
+	// language of the rules given no language
+	Language string `yaml:"language,omitempty"`
+	// command to run the engine
+	Command string `yaml:"command,omitempty"`
+	// output format
+	Format string `yaml:"format,omitempty"`
+	// paths excluded from the scan
+	Exclude []string `yaml:"exclude,omitempty"`
+	// additional rules
+	Configs []string `yaml:"configs,omitempty"`
+	// additional arguments of the engine
+	EngineArgs []string `yaml:"engine-args,omitempty"`
+
+	// files the configuration was loaded from
+	Files []string `yaml:"-"`
+}
+
+// Path of the user configuration, in $XDG_CONFIG_HOME or ~/.config.
+func UserPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "semsearch", "config.yaml")
+}
+
+// Path of the project configuration of the directory, empty when neither the
+// directory nor its parents have one.
+func ProjectPath(dir string) string {
+	for {
+		path := filepath.Join(dir, PROJECT_FILE)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Load the user configuration and the project configuration of the
+// directory. Missing files are skipped. The engine command and its arguments
+// are only read from the user configuration, a project checked out from
+// elsewhere must not choose the programs semsearch runs.
+func Load(dir string) (*Config, error) {
+	c := &Config{}
+	for _, path := range []string{UserPath(), ProjectPath(dir)} {
+		if path == "" {
+			continue
+		}
+		file, err := LoadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path != UserPath() && (file.Command != "" || len(file.EngineArgs) > 0) {
+			return nil, fmt.Errorf("invalid configuration %s: command and engine-args are only read from the user configuration %s", path, UserPath())
+		}
+		c.Merge(file)
+	}
+	return c, nil
+}
+
+// Load a configuration file. Unknown keys are errors.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	if c.Format != "" && !rule.Formats[c.Format] {
+		return nil, fmt.Errorf("invalid configuration %s: unknown output format '%s'", path, c.Format)
+	}
+	c.Files = []string{path}
+	return c, nil
+}
+
+// Override the values of the configuration and add to its lists.
+func (c *Config) Merge(other *Config) *Config {
+	if other.Language != "" {
+		c.Language = other.Language
+	}
+	if other.Command != "" {
+		c.Command = other.Command
+	}
+	if other.Format != "" {
+		c.Format = other.Format
+	}
+	c.Exclude = append(c.Exclude, other.Exclude...)
+	c.Configs = append(c.Configs, other.Configs...)
+	c.EngineArgs = append(c.EngineArgs, other.EngineArgs...)
+	c.Files = append(c.Files, other.Files...)
+	return c
+}
+
+// Set the defaults of the configuration on a state before parsing the command
+// line.
+func (c *Config) Apply(s *rule.State) *rule.State {
+	if c.Language != "" {
+		s.DefaultLanguage(c.Language)
+	}
+	if c.Command != "" {
+		s.Command(c.Command)
+	}
+	if c.Format != "" {
+		s.Format(c.Format)
+	}
+	for _, exclude := range c.Exclude {
+		s.Exclude(exclude)
+	}
+	for _, config := range c.Configs {
+		s.Config(config)
+	}
+	s.EngineArgs(c.EngineArgs...)
+	return s
+}
+
+// Serialize the configuration to YAML, with the files it was loaded from as
+// comments.
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	header := ""
+	for _, file := range c.Files {
+		header += "# " + file + "\n"
+	}
+	if string(data) == "{}\n" {
+		data = nil
+	}
+	return header + string(data)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/becojo/semsearch/pkg/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	write(t, filepath.Join(dir, "xdg", "semsearch", "config.yaml"), "language: go\nformat: json\nexclude: [vendor]\nengine-args: [--timeout, \"5\"]\n")
+	write(t, filepath.Join(dir, "project", PROJECT_FILE), "format: sarif\nexclude: [testdata]\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "project", "sub"), 0755))
+
+	c, err := Load(filepath.Join(dir, "project", "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, "go", c.Language)
+	assert.Equal(t, "sarif", c.Format)
+	assert.Equal(t, []string{"vendor", "testdata"}, c.Exclude)
+	assert.Equal(t, []string{"--timeout", "5"}, c.EngineArgs)
+	assert.Equal(t, []string{filepath.Join(dir, "xdg", "semsearch", "config.yaml"), filepath.Join(dir, "project", PROJECT_FILE)}, c.Files)
+}
+
+func TestLoadProjectCommand(t *testing.T) {
+	for _, content := range []string{"command: ./run.sh\n", "engine-args: [--config, evil.yaml]\n"} {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+		write(t, filepath.Join(dir, PROJECT_FILE), content)
+
+		_, err := Load(dir)
+		assert.ErrorContains(t, err, "command and engine-args are only read from the user configuration", content)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	c, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "", c.String())
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "unknown.yaml"), "langage: go\n")
+	write(t, filepath.Join(dir, "format.yaml"), "format: xml\n")
+
+	_, err := LoadFile(filepath.Join(dir, "unknown.yaml"))
+	assert.ErrorContains(t, err, "field langage not found")
+	_, err = LoadFile(filepath.Join(dir, "format.yaml"))
+	assert.ErrorContains(t, err, "unknown output format 'xml'")
+}
+
+func TestApply(t *testing.T) {
+	c := &Config{Language: "go"}
+	state := c.Apply(rule.Builder()).Rule().Pattern("foo").Rule().Language("python").Pattern("bar")
+	assert.Equal(t, []string{"go"}, state.Rules()[0].Languages)
+	assert.Equal(t, []string{"python"}, state.Rules()[1].Languages)
+
+	rules, err := state.MarshalRules()
+	require.NoError(t, err)
+	assert.Contains(t, string(rules), "languages:\n  - go\n  patterns:\n  - pattern: foo")
+	assert.Contains(t, string(rules), "languages:\n  - python\n  patterns:\n  - pattern: bar")
+}
+
+func TestApplyFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write(t, path, "rules:\n- id: loaded\n  languages: [python]\n  pattern: foo()\n")
+
+	c := &Config{Language: "go"}
+	state := c.Apply(rule.Builder()).Rule().Load(path)
+	require.NoError(t, state.Err())
+
+	rules, err := state.MarshalRules()
+	require.NoError(t, err)
+	assert.NotContains(t, string(rules), "rule-1")
+	assert.Contains(t, string(rules), "id: loaded")
+}
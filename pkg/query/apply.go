@@ -0,0 +1,227 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/becojo/semsearch/pkg/rule"
+)
+
+// Parse a query and add its patterns to the current pattern group of the
+// state. The arguments of a top-level all() are added to the group directly.
+func Apply(s *rule.State, src string) error {
+	node, err := Parse(src)
+	if err != nil {
+		return err
+	}
+	if node.Kind == TOKEN_IDENT && node.Name == "all" {
+		return applyAll(s, node.Args)
+	}
+	return node.apply(s)
+}
+
+// Apply the query of a .sq file. Errors are prefixed with the path.
+func ApplyFile(s *rule.State, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := Apply(s, string(data)); err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	return nil
+}
+
+// Whether a query argument names a query file.
+func IsFile(arg string) bool {
+	return strings.HasSuffix(arg, ".sq")
+}
+
+func applyAll(s *rule.State, nodes []*Node) error {
+	for _, node := range nodes {
+		if err := node.apply(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Node) apply(s *rule.State) error {
+	switch n.Kind {
+	case TOKEN_PATTERN:
+		s.Pattern(n.Value)
+		return nil
+	case TOKEN_IDENT:
+	default:
+		return n.pos.errorf("expected a pattern or an operator, found %s (patterns are written p\"...\")", n)
+	}
+
+	switch n.Name {
+	case "all":
+		s.Patterns()
+		if err := applyAll(s, n.Args); err != nil {
+			return err
+		}
+		s.Pop()
+	case "any":
+		s.PatternEither()
+		if err := applyAll(s, n.Args); err != nil {
+			return err
+		}
+		s.Pop()
+	case "not":
+		return n.applyNot(s)
+	case "inside":
+		pattern, err := n.args(TOKEN_PATTERN)
+		if err != nil {
+			return err
+		}
+		s.PatternInside(pattern[0])
+	case "regex":
+		if len(n.Args) == 2 {
+			args, err := n.args(TOKEN_METAVARIABLE, TOKEN_STRING)
+			if err != nil {
+				return err
+			}
+			s.MetavariableRegex(args[0], args[1])
+			return nil
+		}
+		args, err := n.args(TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.PatternRegex(args[0])
+	case "focus":
+		args, err := n.args(TOKEN_METAVARIABLE)
+		if err != nil {
+			return err
+		}
+		s.FocusMetavariable(args[0])
+	case "compare":
+		return n.applyCompare(s)
+	case "analysis":
+		args, err := n.args(TOKEN_METAVARIABLE, TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.MetavariableAnalysis(args[0], args[1])
+	case "type":
+		args, err := n.args(TOKEN_METAVARIABLE, TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.MetavariableType(args[0], args[1])
+	case "name":
+		args, err := n.args(TOKEN_METAVARIABLE, TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.MetavariableName(args[0], args[1])
+	case "metavariable":
+		return n.applyMetavariable(s)
+	default:
+		return n.pos.errorf("unknown operator '%s'", n.Name)
+	}
+	return nil
+}
+
+// not p"...", not inside(p"...") or not regex("...")
+func (n *Node) applyNot(s *rule.State) error {
+	if len(n.Args) != 1 {
+		return n.pos.errorf("not expects 1 argument, found %d", len(n.Args))
+	}
+	arg := n.Args[0]
+	switch {
+	case arg.Kind == TOKEN_PATTERN:
+		s.PatternNot(arg.Value)
+	case arg.Kind == TOKEN_IDENT && arg.Name == "inside":
+		pattern, err := arg.args(TOKEN_PATTERN)
+		if err != nil {
+			return err
+		}
+		s.PatternNotInside(pattern[0])
+	case arg.Kind == TOKEN_IDENT && arg.Name == "regex" && len(arg.Args) == 1:
+		regex, err := arg.args(TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.PatternNotRegex(regex[0])
+	default:
+		return arg.pos.errorf("not applies to a pattern, inside() or regex(), found %s", arg)
+	}
+	return nil
+}
+
+// compare([$X,] "...", [base(N),] [strip])
+func (n *Node) applyCompare(s *rule.State) error {
+	args := n.Args
+	metavariable := ""
+	if len(args) > 0 && args[0].Kind == TOKEN_METAVARIABLE {
+		metavariable, args = args[0].Value, args[1:]
+	}
+	if len(args) == 0 || args[0].Kind != TOKEN_STRING {
+		return n.pos.errorf("compare expects a comparison string")
+	}
+	s.MetavariableComparison(args[0].Value)
+	if metavariable != "" {
+		s.ComparisonMetavariable(metavariable)
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case arg.Kind == TOKEN_STRING && arg.Value == "strip":
+			s.ComparisonStrip()
+		case arg.Kind == TOKEN_IDENT && arg.Name == "base":
+			base, err := arg.args(TOKEN_STRING)
+			if err != nil {
+				return err
+			}
+			s.ComparisonBase(base[0])
+		default:
+			return arg.pos.errorf("compare options are base(N) and strip, found %s", arg)
+		}
+	}
+	return nil
+}
+
+// metavariable($X, ["language",] patterns...) or metavariable($X, regex("..."))
+func (n *Node) applyMetavariable(s *rule.State) error {
+	if len(n.Args) < 2 || n.Args[0].Kind != TOKEN_METAVARIABLE {
+		return n.pos.errorf("metavariable expects a metavariable and patterns")
+	}
+	args := n.Args[1:]
+	// metavariable($X, regex("...")) is a pattern-regex of the metavariable
+	if len(args) == 1 && args[0].Kind == TOKEN_IDENT && args[0].Name == "regex" && len(args[0].Args) == 1 {
+		regex, err := args[0].args(TOKEN_STRING)
+		if err != nil {
+			return err
+		}
+		s.MetavariablePatternRegex(n.Args[0].Value, regex[0])
+		return nil
+	}
+	language := ""
+	if args[0].Kind == TOKEN_STRING {
+		language, args = args[0].Value, args[1:]
+	}
+	s.MetavariablePatternWithLanguage(n.Args[0].Value, language)
+	if err := applyAll(s, args); err != nil {
+		return err
+	}
+	s.Pop()
+	return nil
+}
+
+// Check the kinds of the arguments of a call and return their values.
+func (n *Node) args(kinds ...TokenKind) ([]string, error) {
+	if len(n.Args) != len(kinds) {
+		return nil, n.pos.errorf("%s expects %d argument(s), found %d", n.Name, len(kinds), len(n.Args))
+	}
+	values := []string{}
+	for i, arg := range n.Args {
+		if arg.Kind != kinds[i] {
+			return nil, arg.pos.errorf("argument %d of %s must be a %s, found %s", i+1, n.Name, tokenNames[kinds[i]], arg)
+		}
+		values = append(values, arg.Value)
+	}
+	return values, nil
+}
@@ -0,0 +1,305 @@
+// Package query parses the compact query language into rule patterns.
+//
+//	all(p"foo($X)", not inside(p"try { ... }"), regex($X, "^a"))
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Syntax error of a query.
+type Error struct {
+	// position of the error, starting at 1
+	Line   int
+	Column int
+
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Kind of token, also the kind of node.
+type TokenKind int
+
+const (
+	TOKEN_EOF TokenKind = iota
+	TOKEN_IDENT
+	TOKEN_METAVARIABLE
+	TOKEN_STRING
+	TOKEN_PATTERN
+	TOKEN_LPAREN
+	TOKEN_RPAREN
+	TOKEN_COMMA
+)
+
+var tokenNames = map[TokenKind]string{
+	TOKEN_EOF:          "end of query",
+	TOKEN_IDENT:        "name",
+	TOKEN_METAVARIABLE: "metavariable",
+	TOKEN_STRING:       "string",
+	TOKEN_PATTERN:      "pattern",
+	TOKEN_LPAREN:       "'('",
+	TOKEN_RPAREN:       "')'",
+	TOKEN_COMMA:        "','",
+}
+
+type token struct {
+	kind  TokenKind
+	value string
+	pos   position
+}
+
+type position struct {
+	line   int
+	column int
+}
+
+func (p position) errorf(format string, args ...any) *Error {
+	return &Error{Line: p.line, Column: p.column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Node of a parsed query. Calls have a name and arguments, the other nodes a
+// value.
+type Node struct {
+	Kind  TokenKind
+	Name  string
+	Value string
+	Args  []*Node
+
+	pos position
+}
+
+type lexer struct {
+	src  []rune
+	i    int
+	line int
+	col  int
+}
+
+func (l *lexer) peek() rune {
+	if l.i >= len(l.src) {
+		return 0
+	}
+	return l.src[l.i]
+}
+
+func (l *lexer) advance() rune {
+	r := l.src[l.i]
+	l.i++
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) skip() {
+	for l.i < len(l.src) {
+		switch r := l.peek(); {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '#':
+			for l.i < len(l.src) && l.peek() != '\n' {
+				l.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skip()
+	pos := position{l.line, l.col}
+	if l.i >= len(l.src) {
+		return token{kind: TOKEN_EOF, pos: pos}, nil
+	}
+
+	switch r := l.peek(); {
+	case r == '(':
+		l.advance()
+		return token{kind: TOKEN_LPAREN, value: "(", pos: pos}, nil
+	case r == ')':
+		l.advance()
+		return token{kind: TOKEN_RPAREN, value: ")", pos: pos}, nil
+	case r == ',':
+		l.advance()
+		return token{kind: TOKEN_COMMA, value: ",", pos: pos}, nil
+	case r == '"' || r == '`':
+		value, err := l.string(pos)
+		return token{kind: TOKEN_STRING, value: value, pos: pos}, err
+	case r == 'p' && l.i+1 < len(l.src) && (l.src[l.i+1] == '"' || l.src[l.i+1] == '`'):
+		l.advance()
+		value, err := l.string(pos)
+		return token{kind: TOKEN_PATTERN, value: value, pos: pos}, err
+	case r == '$':
+		l.advance()
+		name := l.word()
+		if name == "" {
+			return token{}, pos.errorf("expected a metavariable name after '$'")
+		}
+		return token{kind: TOKEN_METAVARIABLE, value: "$" + name, pos: pos}, nil
+	case isWord(r):
+		return token{kind: TOKEN_IDENT, value: l.word(), pos: pos}, nil
+	default:
+		return token{}, pos.errorf("unexpected character %q", r)
+	}
+}
+
+func isWord(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) word() string {
+	start := l.i
+	for l.i < len(l.src) && isWord(l.peek()) {
+		l.advance()
+	}
+	return string(l.src[start:l.i])
+}
+
+// Read a double quoted string with Go escapes, or a raw backquoted string.
+func (l *lexer) string(pos position) (string, error) {
+	quote := l.advance()
+	start := l.i
+	for l.i < len(l.src) {
+		r := l.advance()
+		switch {
+		case r == '\\' && quote == '"' && l.i < len(l.src):
+			l.advance()
+		case r == '\n' && quote == '"':
+			return "", pos.errorf("unterminated string")
+		case r == quote:
+			raw := string(l.src[start-1 : l.i])
+			if quote == '`' {
+				return raw[1 : len(raw)-1], nil
+			}
+			value, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", pos.errorf("invalid string %s", raw)
+			}
+			return value, nil
+		}
+	}
+	return "", pos.errorf("unterminated string")
+}
+
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	p.tok = tok
+	return err
+}
+
+func (p *parser) expect(kind TokenKind) (token, error) {
+	tok := p.tok
+	if tok.kind != kind {
+		return tok, tok.pos.errorf("expected %s, found %s", tokenNames[kind], describe(tok))
+	}
+	return tok, p.advance()
+}
+
+func describe(tok token) string {
+	if tok.kind == TOKEN_EOF {
+		return tokenNames[TOKEN_EOF]
+	}
+	return fmt.Sprintf("%s %s", tokenNames[tok.kind], strconv.Quote(tok.value))
+}
+
+// Parse a query in a tree of nodes.
+func Parse(src string) (*Node, error) {
+	p := &parser{lexer: &lexer{src: []rune(src), line: 1, col: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	node, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_EOF); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (p *parser) expr() (*Node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case TOKEN_STRING, TOKEN_PATTERN, TOKEN_METAVARIABLE:
+		return &Node{Kind: tok.kind, Value: tok.value, pos: tok.pos}, p.advance()
+	case TOKEN_IDENT:
+	default:
+		return nil, tok.pos.errorf("expected an expression, found %s", describe(tok))
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	node := &Node{Kind: TOKEN_IDENT, Name: tok.value, pos: tok.pos}
+
+	// not takes its operand without parentheses: not inside(p"...")
+	if tok.value == "not" && p.tok.kind != TOKEN_LPAREN {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		node.Args = []*Node{arg}
+		return node, nil
+	}
+
+	// bare names are values, such as the analyzer of analysis($X, entropy)
+	switch p.tok.kind {
+	case TOKEN_COMMA, TOKEN_RPAREN, TOKEN_EOF:
+		return &Node{Kind: TOKEN_STRING, Value: tok.value, pos: tok.pos}, nil
+	case TOKEN_LPAREN:
+	default:
+		return nil, p.tok.pos.errorf("expected '(' after '%s', found %s", tok.value, describe(p.tok))
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for p.tok.kind != TOKEN_RPAREN {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		node.Args = append(node.Args, arg)
+		if p.tok.kind != TOKEN_COMMA {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (n *Node) String() string {
+	switch n.Kind {
+	case TOKEN_PATTERN:
+		return "p" + strconv.Quote(n.Value)
+	case TOKEN_STRING:
+		return strconv.Quote(n.Value)
+	case TOKEN_METAVARIABLE:
+		return n.Value
+	}
+	args := []string{}
+	for _, arg := range n.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", n.Name, strings.Join(args, ", "))
+}
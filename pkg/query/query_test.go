@@ -0,0 +1,146 @@
+package query
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/becojo/semsearch/pkg/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func marshal(t *testing.T, s *rule.State) string {
+	t.Helper()
+	require.NoError(t, s.Err())
+	rules, err := s.MarshalRules()
+	require.NoError(t, err)
+	return string(rules)
+}
+
+func TestApplyMatchesBuilder(t *testing.T) {
+	state := rule.Builder().Rule().Language("go")
+	err := Apply(state, `all(
+		p"foo($X, $Y)",
+		not inside(p"try { ... }"),
+		regex($X, "^a"),
+		any(p"$Y == 1", p"$Y == \"x\""),
+		not p"foo(1, 2)",
+		metavariable($Y, "python", all(p"int($Z)", not regex("^x"))),
+		focus($X),  # trailing comma and comments are allowed
+	)`)
+	require.NoError(t, err)
+
+	expected := rule.Builder().
+		Rule().
+		Language("go").
+		Pattern("foo($X, $Y)").
+		PatternNotInside("try { ... }").
+		MetavariableRegex("X", "^a").
+		PatternEither().
+		Pattern("$Y == 1").
+		Pattern(`$Y == "x"`).
+		Pop().
+		PatternNot("foo(1, 2)").
+		MetavariablePatternWithLanguage("Y", "python").
+		Patterns().
+		Pattern("int($Z)").
+		PatternNotRegex("^x").
+		Pop().
+		Pop().
+		FocusMetavariable("X")
+
+	assert.Equal(t, marshal(t, expected), marshal(t, state))
+}
+
+func TestApplyMetavariableConstraints(t *testing.T) {
+	state := rule.Builder().Rule()
+	err := Apply(state, `all(p"f($X, $Y)", compare("$X > 1"), analysis($X, entropy), type($Y, "int"), name($Y, "os"))`)
+	require.NoError(t, err)
+
+	expected := rule.Builder().
+		Rule().
+		Pattern("f($X, $Y)").
+		MetavariableComparison("$X > 1").
+		MetavariableAnalysis("X", "entropy").
+		MetavariableType("Y", "int").
+		MetavariableName("Y", "os")
+
+	assert.Equal(t, marshal(t, expected), marshal(t, state))
+}
+
+func TestApplyCompare(t *testing.T) {
+	state := rule.Builder().Rule()
+	err := Apply(state, `all(p"chmod($MODE)", compare($MODE, "$MODE > 644", base(8), strip))`)
+	require.NoError(t, err)
+
+	expected := rule.Builder().
+		Rule().
+		Pattern("chmod($MODE)").
+		MetavariableComparison("$MODE > 644").
+		ComparisonMetavariable("MODE").
+		ComparisonBase("8").
+		ComparisonStrip()
+
+	assert.Equal(t, marshal(t, expected), marshal(t, state))
+}
+
+func TestApplyMetavariableRegex(t *testing.T) {
+	state := rule.Builder().Rule()
+	err := Apply(state, `all(p"get($URL)", metavariable($URL, regex("^http://")))`)
+	require.NoError(t, err)
+
+	expected := rule.Builder().
+		Rule().
+		Pattern("get($URL)").
+		MetavariablePatternRegex("URL", "^http://")
+
+	assert.Equal(t, marshal(t, expected), marshal(t, state))
+}
+
+func TestApplyRawPattern(t *testing.T) {
+	state := rule.Builder().Rule()
+	require.NoError(t, Apply(state, "p`foo(\"\\d\")`"))
+	assert.Equal(t, marshal(t, rule.Builder().Rule().Pattern(`foo("\d")`)), marshal(t, state))
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		line    int
+		column  int
+		message string
+	}{
+		{`all(p"foo"`, 1, 11, "expected ')', found end of query"},
+		{"all(p\"foo\",\n  nott p\"x\")", 2, 8, "expected '(' after 'nott', found pattern \"x\""},
+		{`all(p"foo", "bar")`, 1, 13, `expected a pattern or an operator, found "bar" (patterns are written p"...")`},
+		{`any(p"foo) `, 1, 5, "unterminated string"},
+		{`all(p"a") p"b"`, 1, 11, `expected end of query, found pattern "b"`},
+		{`inside("foo")`, 1, 8, `argument 1 of inside must be a pattern, found "foo"`},
+		{`some(p"x")`, 1, 1, "unknown operator 'some'"},
+		{`all(p"a", ?)`, 1, 11, "unexpected character '?'"},
+		{`compare($X)`, 1, 1, "compare expects a comparison string"},
+		{`compare("$X > 1", round)`, 1, 19, `compare options are base(N) and strip, found "round"`},
+	}
+
+	for _, test := range tests {
+		err := Apply(rule.Builder().Rule(), test.query)
+		var e *Error
+		if assert.True(t, errors.As(err, &e), test.query) {
+			assert.Equal(t, test.line, e.Line, test.query)
+			assert.Equal(t, test.column, e.Column, test.query)
+			assert.Equal(t, test.message, e.Message)
+		}
+	}
+}
+
+func TestApplyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rule.sq")
+	require.NoError(t, os.WriteFile(path, []byte("# calls to foo\nall(p\"foo($X)\",\n  focus($X)\n"), 0644))
+
+	err := ApplyFile(rule.Builder().Rule(), path)
+	assert.EqualError(t, err, path+":4:1: expected ')', found end of query")
+	assert.True(t, IsFile(path))
+	assert.False(t, IsFile(`p"foo.sq"`+" "))
+}
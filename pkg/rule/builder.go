@@ -1,7 +1,10 @@
 package rule
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
 	"go.yaml.in/yaml/v2"
@@ -21,6 +24,9 @@ var Formats = map[string]bool{
 type State struct {
 	// rules to run
 	rules []*Rule
+	// number of rules created or loaded, join rules keep their sub-rules out
+	// of rules so generated IDs are numbered from it
+	count int
 	// stack of patterns
 	stack []*[]Pattern
 	// paths to file or directories to scan
@@ -31,18 +37,36 @@ type State struct {
 	evals []string
 	// paths to additional rules
 	configs []string
-	// errors encountered during rule building
-	warnings []string
+	// problems encountered during rule building
+	warnings []*Diagnostic
+	// errors preventing the rules from being used
+	errors []error
 	// autofix enabled
 	autofix bool
+	// warnings are errors
+	strict bool
 	// debug mode
 	debug bool
 	// export mode
 	export bool
+	// taint group receiving the taint options
+	taint *TaintSpec
+	// section of the current taint group
+	taintSection string
+	// propagator group receiving the from/to metavariables
+	propagator *PatternPropagator
+	// command line argument currently applied
+	origin Origin
 	// command to run opengrep
 	command string
 	// opengrep verbose mode
 	verbose bool
+	// language of the rules without languages
+	language string
+	// paths excluded from the scan by the engine
+	excludes []string
+	// additional arguments of the engine
+	engineArgs []string
 }
 
 func Builder() *State {
@@ -55,14 +79,29 @@ func Builder() *State {
 }
 
 func (s *State) pushPattern(p Pattern) {
-	head := s.stack[len(s.stack)-1]
-	if head == nil {
-		s.warn("no pattern stack available to push pattern")
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] == nil {
+		if s.InJoin() {
+			d := s.diagnostic(DIAGNOSTIC_ERROR, "pattern added to a join rule")
+			d.Hint = "add the pattern to a rule before --join"
+			s.fail(d)
+			return
+		}
+		d := s.diagnostic(DIAGNOSTIC_ERROR, "pattern added after leaving the top-level pattern group")
+		d.Hint = "remove a ^ before this pattern or start a new rule with --rule"
+		s.fail(d)
 		return
 	}
+	head := s.stack[len(s.stack)-1]
+	p.origin = s.origin
 	*head = append(*head, p)
 }
 
+// Record the command line argument producing the next changes to the rules.
+func (s *State) At(index int, flag string) *State {
+	s.origin = Origin{Index: index, Flag: flag}
+	return s
+}
+
 func (s *State) headRule() *Rule {
 	if len(s.rules) == 0 {
 		return &Rule{}
@@ -70,14 +109,46 @@ func (s *State) headRule() *Rule {
 	return s.rules[len(s.rules)-1]
 }
 
-func (s *State) warn(message string) {
-	s.warnings = append(s.warnings, message)
+func (s *State) warn(message string) *Diagnostic {
+	d := s.diagnostic(DIAGNOSTIC_WARNING, message)
+	s.warnings = append(s.warnings, d)
+	return d
+}
+
+func (s *State) fail(err error) {
+	s.errors = append(s.errors, err)
+}
+
+// Record an error caused by the current argument.
+func (s *State) Fail(message string) *State {
+	s.fail(s.diagnostic(DIAGNOSTIC_ERROR, message))
+	return s
+}
+
+// Return the errors encountered while building the rules. In strict mode the
+// warnings are errors too.
+func (s *State) Err() error {
+	errs := append([]error{}, s.errors...)
+	if s.strict && len(s.warnings) > 0 {
+		errs = append(errs, &Diagnostic{
+			Severity: DIAGNOSTIC_ERROR,
+			Message:  fmt.Sprintf("%d warning(s) treated as errors", len(s.warnings)),
+			Hint:     "remove --strict to run the rules anyway",
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// Treat warnings as errors.
+func (s *State) Strict() *State {
+	s.strict = true
+	return s
 }
 
 // Set the output format of the findings.
 func (s *State) Format(format string) *State {
 	if !Formats[format] {
-		s.warn(fmt.Sprintf("unknown output format '%s'", format))
+		s.warn(fmt.Sprintf("unknown output format '%s'", format)).Hint = hintOneOf(format, keys(Formats))
 	}
 	s.format = format
 	return s
@@ -89,16 +160,23 @@ func (s *State) Export() *State {
 	return s
 }
 
+// Rules built so far.
+func (s *State) Rules() []*Rule {
+	return s.rules
+}
+
 // Serialize the rules to YAML format.
-func (s *State) MarshalRules() []byte {
+func (s *State) MarshalRules() ([]byte, error) {
+	if err := s.checkStructure(); err != nil {
+		return nil, err
+	}
 	y, err := yaml.Marshal(map[string]any{
 		"rules": s.rules,
 	})
 	if err != nil {
-		s.warn(fmt.Sprintf("failed to marshal rules: %v", err))
-		return nil
+		return nil, fmt.Errorf("failed to marshal rules: %w", err)
 	}
-	return y
+	return y, nil
 }
 
 // Enable debug mode
@@ -109,21 +187,111 @@ func (s *State) Debug() *State {
 
 // Create a new rule in the state.
 func (s *State) Rule() *State {
+	s.count += 1
 	r := Rule{
-		Id:       fmt.Sprintf("rule-%d", len(s.rules)+1),
-		Patterns: &[]Pattern{},
-		Severity: SEVERITY_WARNING,
-		Metadata: map[string]any{},
-		Options:  map[string]any{},
+		Id:          fmt.Sprintf("rule-%d", s.count),
+		generatedID: true,
+		Patterns:    &[]Pattern{},
+		Severity:    SEVERITY_WARNING,
+		Metadata:    map[string]any{},
+		Options:     map[string]any{},
+		origin:      s.origin,
 	}
 
 	if len(s.rules) > 0 {
 		h := s.headRule()
-		r.Languages = append(r.Languages, h.Languages...)
+		if h.Extract != "" && h.DestLanguage != "" {
+			// rules following an extract rule search the extracted content
+			r.Languages = append(r.Languages, h.DestLanguage)
+		} else {
+			r.Languages = append(r.Languages, h.Languages...)
+			r.defaultLanguage = h.defaultLanguage
+		}
 		r.Severity = h.Severity
+	} else if s.language != "" {
+		r.Languages = []string{s.language}
+		r.defaultLanguage = true
 	}
 	s.rules = append(s.rules, &r)
 	s.stack = []*[]Pattern{r.Patterns}
+	s.taint = nil
+	s.propagator = nil
+	return s
+}
+
+// Create a join rule combining the previously created rules.
+func (s *State) Join() *State {
+	s.Rule()
+	r := s.headRule()
+	r.Join = &RuleJoin{Rules: s.rules[:len(s.rules)-1]}
+	s.rules = []*Rule{r}
+	// a join rule has no patterns of its own
+	s.stack = []*[]Pattern{nil}
+	return s
+}
+
+// Add a condition on the metavariables of the current join rule.
+func (s *State) On(condition string) *State {
+	r := s.headRule()
+	if r.Join == nil {
+		s.warn(fmt.Sprintf("no join rule to add condition '%s' to", condition)).Hint = "start a join rule with --join first"
+		return s
+	}
+	r.Join.On = append(r.Join.On, condition)
+	return s
+}
+
+// Add a rule file reference to the current join rule, optionally aliased.
+func (s *State) JoinRef(path string, alias string) *State {
+	r := s.headRule()
+	if r.Join == nil {
+		s.warn(fmt.Sprintf("no join rule to add reference '%s' to", path)).Hint = "start a join rule with --join first"
+		return s
+	}
+	r.Join.Refs = append(r.Join.Refs, JoinRef{Rule: path, As: alias})
+	return s
+}
+
+// Extract the content of the metavariable to search it with the other rules.
+func (s *State) Extract(metavariable string) *State {
+	r := s.headRule()
+	r.Extract = normalizeMetavariable(metavariable)
+	r.extractOrigin = s.origin
+	return s
+}
+
+// Set the language of the content extracted by the current rule.
+func (s *State) DestLanguage(lang string) *State {
+	r := s.headRule()
+	r.DestLanguage = lang
+	return s
+}
+
+// Limit the rules run on the content extracted by the current rule to the
+// rule ID.
+func (s *State) DestRules(id string) *State {
+	r := s.headRule()
+	r.DestRules = append(r.DestRules, id)
+	return s
+}
+
+// Set the transformation applied to the extracted content.
+func (s *State) Transform(transform string) *State {
+	r := s.headRule()
+	r.Transform = transform
+	return s
+}
+
+// Set how the extracted contents of a file are combined, either concat or
+// separate.
+func (s *State) Reduce(reduce string) *State {
+	r := s.headRule()
+	reduce = strings.ToLower(reduce)
+	if reduce != REDUCE_CONCAT && reduce != REDUCE_SEPARATE {
+		s.warn(fmt.Sprintf("unknown reduce '%s', expected %s or %s", reduce, REDUCE_CONCAT, REDUCE_SEPARATE)).Hint = hintOneOf(reduce, []string{REDUCE_CONCAT, REDUCE_SEPARATE})
+		return s
+	}
+	r.Reduce = reduce
 	return s
 }
 
@@ -133,25 +301,181 @@ func (s *State) Path(path string) *State {
 	return s
 }
 
-// Set the pattern sources for the current rule.
+// Return the paths to search.
+func (s *State) Paths() []string {
+	return s.paths
+}
+
+// Options of the state that are not part of the rules.
+type RunOptions struct {
+	Paths   []string
+	Evals   []string
+	Configs []string
+	Format  string
+	Command string
+	Autofix bool
+	Strict  bool
+	Debug   bool
+	Verbose bool
+	Export  bool
+}
+
+// Return the options of the run.
+func (s *State) RunOptions() RunOptions {
+	return RunOptions{
+		Paths:   s.paths,
+		Evals:   s.evals,
+		Configs: s.configs,
+		Format:  s.format,
+		Command: s.command,
+		Autofix: s.autofix,
+		Strict:  s.strict,
+		Debug:   s.debug,
+		Verbose: s.verbose,
+		Export:  s.export,
+	}
+}
+
+// Add a pattern sources group to the current rule.
 func (s *State) PatternSources() *State {
 	r := s.headRule()
-	r.PatternSources = &[]Pattern{}
-	s.stack = []*[]Pattern{r.PatternSources}
+	r.PatternSources = s.pushTaintSpec(r.PatternSources, TAINT_SOURCES)
 	return s
 }
 
-// Set the pattern sinks for the current rule.
+// Add a pattern sinks group to the current rule.
 func (s *State) PatternSinks() *State {
 	r := s.headRule()
-	r.PatternSinks = &[]Pattern{}
-	s.stack = []*[]Pattern{r.PatternSinks}
+	r.PatternSinks = s.pushTaintSpec(r.PatternSinks, TAINT_SINKS)
+	return s
+}
+
+// Add a pattern sanitizers group to the current rule.
+func (s *State) PatternSanitizers() *State {
+	r := s.headRule()
+	r.PatternSanitizers = s.pushTaintSpec(r.PatternSanitizers, TAINT_SANITIZERS)
+	return s
+}
+
+func (s *State) pushTaintSpec(specs *[]TaintSpec, section string) *[]TaintSpec {
+	if specs == nil {
+		specs = &[]TaintSpec{}
+	}
+	*specs = append(*specs, TaintSpec{Patterns: &[]Pattern{}, origin: s.origin})
+	s.taint = &(*specs)[len(*specs)-1]
+	s.taintSection = section
+	s.propagator = nil
+	s.stack = []*[]Pattern{s.taint.Patterns}
+	return specs
+}
+
+// Set the label of the current taint source group.
+func (s *State) Label(label string) *State {
+	if t := s.taintSpec("label", TAINT_SOURCES); t != nil {
+		t.Label = label
+	}
+	return s
+}
+
+// Set the labels required by the current taint source or sink group.
+func (s *State) Requires(expr string) *State {
+	if t := s.taintSpec("requires", TAINT_SOURCES, TAINT_SINKS); t != nil {
+		t.Requires = expr
+	}
+	return s
+}
+
+// Set whether the current taint source or sanitizer group applies by side
+// effect. The value is one of true, false or only.
+func (s *State) BySideEffect(value string) *State {
+	value = strings.ToLower(value)
+	if value != "true" && value != "false" && value != "only" {
+		s.warn(fmt.Sprintf("invalid by-side-effect value '%s', expected true, false or only", value))
+		return s
+	}
+	if t := s.taintSpec("by-side-effect", TAINT_SOURCES, TAINT_SANITIZERS); t != nil {
+		t.BySideEffect = value
+	}
+	return s
+}
+
+// Set whether the current taint group only matches exactly. The value is
+// either true or false.
+func (s *State) Exact(value string) *State {
+	exact, err := strconv.ParseBool(value)
+	if err != nil {
+		s.warn(fmt.Sprintf("invalid exact value '%s', expected true or false", value))
+		return s
+	}
+	if t := s.taintSpec("exact", TAINT_SOURCES, TAINT_SINKS, TAINT_SANITIZERS); t != nil {
+		t.Exact = &exact
+	}
+	return s
+}
+
+// Mark the current taint source group as a control source.
+func (s *State) Control() *State {
+	if t := s.taintSpec("control", TAINT_SOURCES); t != nil {
+		t.Control = true
+	}
+	return s
+}
+
+// Return the current taint group if its section accepts the attribute.
+func (s *State) taintSpec(attribute string, sections ...string) *TaintSpec {
+	if s.taint == nil {
+		s.warn(fmt.Sprintf("no taint group to set '%s' on", attribute)).Hint = "start a taint group with -pso, -psk or -psa first"
+		return nil
+	}
+	if !slices.Contains(sections, s.taintSection) {
+		s.warn(fmt.Sprintf("'%s' cannot be set on %s", attribute, s.taintSection))
+		return nil
+	}
+	return s.taint
+}
+
+// Add a pattern propagator group to the current rule.
+func (s *State) PatternPropagators() *State {
+	r := s.headRule()
+	if r.PatternPropagators == nil {
+		r.PatternPropagators = &[]PatternPropagator{}
+	}
+	p := PatternPropagator{Patterns: &[]Pattern{}, origin: s.origin}
+	*r.PatternPropagators = append(*r.PatternPropagators, p)
+	s.propagator = &(*r.PatternPropagators)[len(*r.PatternPropagators)-1]
+	s.taint = nil
+	s.stack = []*[]Pattern{p.Patterns}
+	return s
+}
+
+// Set the metavariable taint is propagated from in the current propagator group.
+func (s *State) PropagateFrom(metavariable string) *State {
+	if s.propagator == nil {
+		s.warn("no pattern propagator group to set 'from' on").Hint = "start a propagator group with -ppr first"
+		return s
+	}
+	s.propagator.From = normalizeMetavariable(metavariable)
+	return s
+}
+
+// Set the metavariable taint is propagated to in the current propagator group.
+func (s *State) PropagateTo(metavariable string) *State {
+	if s.propagator == nil {
+		s.warn("no pattern propagator group to set 'to' on").Hint = "start a propagator group with -ppr first"
+		return s
+	}
+	s.propagator.To = normalizeMetavariable(metavariable)
 	return s
 }
 
-// Set the language for the current rule.
+// Set the language for the current rule. The first language replaces the
+// default language.
 func (s *State) Language(lang string) *State {
 	r := s.headRule()
+	if r.defaultLanguage {
+		r.Languages = nil
+		r.defaultLanguage = false
+	}
 	r.Languages = append(r.Languages, lang)
 	return s
 }
@@ -227,12 +551,123 @@ func (s *State) MetavariableRegex(metavariable, regex string) *State {
 	return s
 }
 
+// Add a metavariable comparison to the current rule.
+func (s *State) MetavariableComparison(comparison string) *State {
+	s.pushPattern(Pattern{
+		MetavariableComparison: &MetavariableComparison{
+			Comparison: comparison,
+		},
+	})
+	return s
+}
+
+// Compare the content of a metavariable instead of its value in the last
+// metavariable comparison of the current pattern group.
+func (s *State) ComparisonMetavariable(metavariable string) *State {
+	if c := s.comparison("metavariable"); c != nil {
+		c.Metavariable = normalizeMetavariable(metavariable)
+	}
+	return s
+}
+
+// Set the base of the integers in the last metavariable comparison of the
+// current pattern group.
+func (s *State) ComparisonBase(value string) *State {
+	base, err := strconv.Atoi(value)
+	if err != nil || base < 2 || base > 36 {
+		s.warn(fmt.Sprintf("invalid comparison base '%s', expected an integer from 2 to 36", value))
+		return s
+	}
+	if c := s.comparison("base"); c != nil {
+		c.Base = base
+	}
+	return s
+}
+
+// Strip the quotes of the metavariable before the last metavariable
+// comparison of the current pattern group.
+func (s *State) ComparisonStrip() *State {
+	if c := s.comparison("strip"); c != nil {
+		c.Strip = true
+	}
+	return s
+}
+
+// Return the last metavariable comparison of the current pattern group, or
+// warn that there is none to set the attribute on.
+func (s *State) comparison(attribute string) *MetavariableComparison {
+	if c := s.lastComparison(); c != nil {
+		return c
+	}
+	s.warn(fmt.Sprintf("no metavariable comparison to set '%s' on", attribute)).Hint = "set it right after a metavariable comparison with -mc"
+	return nil
+}
+
+// Metavariable comparison added last to the current pattern group, nil when
+// the last pattern is another kind.
+func (s *State) lastComparison() *MetavariableComparison {
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] == nil {
+		return nil
+	}
+	head := *s.stack[len(s.stack)-1]
+	if len(head) == 0 {
+		return nil
+	}
+	return head[len(head)-1].MetavariableComparison
+}
+
+// Add a metavariable analysis to the current rule.
+func (s *State) MetavariableAnalysis(metavariable, analyzer string) *State {
+	analyzer = strings.ToLower(analyzer)
+	if !analyzers[analyzer] {
+		s.warn(fmt.Sprintf("unknown metavariable analyzer '%s'", analyzer)).Hint = hintOneOf(analyzer, keys(analyzers))
+		return s
+	}
+	s.pushPattern(Pattern{
+		MetavariableAnalysis: &MetavariableAnalysis{
+			Metavariable: normalizeMetavariable(metavariable),
+			Analyzer:     analyzer,
+		},
+	})
+	return s
+}
+
+// Add a metavariable type constraint to the current rule.
+func (s *State) MetavariableType(metavariable, typ string) *State {
+	s.pushPattern(Pattern{
+		MetavariableType: &MetavariableType{
+			Metavariable: normalizeMetavariable(metavariable),
+			Type:         typ,
+		},
+	})
+	return s
+}
+
+// Add a metavariable name constraint on the module the metavariable
+// resolves to in the current rule.
+func (s *State) MetavariableName(metavariable, module string) *State {
+	s.pushPattern(Pattern{
+		MetavariableName: &MetavariableName{
+			Metavariable: normalizeMetavariable(metavariable),
+			Module:       module,
+		},
+	})
+	return s
+}
+
 // Add a metavariable pattern to the current rule.
 func (s *State) MetavariablePattern(metavariable string) *State {
+	return s.MetavariablePatternWithLanguage(metavariable, "")
+}
+
+// Add a metavariable pattern matching the metavariable content as another
+// language to the current rule.
+func (s *State) MetavariablePatternWithLanguage(metavariable, language string) *State {
 	patterns := &[]Pattern{}
 	s.pushPattern(Pattern{
 		MetavariablePattern: &MetavariablePattern{
 			Metavariable: normalizeMetavariable(metavariable),
+			Language:     language,
 			Patterns:     patterns,
 		},
 	})
@@ -240,23 +675,86 @@ func (s *State) MetavariablePattern(metavariable string) *State {
 	return s
 }
 
-// Exit the current pattern group
+// Add a metavariable pattern matching the metavariable content with a regex
+// to the current rule.
+func (s *State) MetavariablePatternRegex(metavariable, regex string) *State {
+	s.pushPattern(Pattern{
+		MetavariablePattern: &MetavariablePattern{
+			Metavariable: normalizeMetavariable(metavariable),
+			PatternRegex: regex,
+		},
+	})
+	return s
+}
+
+// Exit the current pattern group. Leaving the top-level group leaves no group
+// to add patterns to until the next rule or taint section.
 func (s *State) Pop() *State {
 	if len(s.stack) > 1 {
 		s.stack = s.stack[:len(s.stack)-1]
 	} else {
-		s.stack = []*[]Pattern{{}}
+		s.stack = []*[]Pattern{nil}
 	}
 	return s
 }
 
-// Add metadata to the current rule
+// Add metadata to the current rule. Dotted keys create nested maps and
+// repeated keys collect their values in a flat list, except for maps.
 func (s *State) Metadata(key string, value any) *State {
 	r := s.headRule()
-	r.Metadata[key] = value
+	if r.Metadata == nil {
+		r.Metadata = map[string]any{}
+	}
+
+	parts := strings.Split(key, ".")
+	m := r.Metadata
+	for _, part := range parts[:len(parts)-1] {
+		switch v := m[part].(type) {
+		case nil:
+			child := map[string]any{}
+			m[part] = child
+			m = child
+		case map[string]any:
+			m = v
+		default:
+			s.warn(fmt.Sprintf("metadata key '%s' is not a map, cannot set '%s'", part, key))
+			return s
+		}
+	}
+
+	last := parts[len(parts)-1]
+	switch v := m[last].(type) {
+	case nil:
+		m[last] = value
+	case map[string]any:
+		s.warn(fmt.Sprintf("metadata key '%s' is a map, cannot add a value to it", key)).Hint = fmt.Sprintf("set a key of the map with %s.<name>", key)
+	case []any:
+		m[last] = appendValues(v, value)
+	default:
+		m[last] = appendValues([]any{v}, value)
+	}
 	return s
 }
 
+// Append a value to a list of metadata values, the values of a list are
+// appended one by one.
+func appendValues(values []any, value any) []any {
+	if list, ok := value.([]any); ok {
+		return append(values, list...)
+	}
+	return append(values, value)
+}
+
+// Add metadata parsed from a YAML or JSON value to the current rule.
+func (s *State) MetadataValue(key string, value string) *State {
+	var v any
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		s.warn(fmt.Sprintf("invalid metadata value for '%s': %v", key, err))
+		return s
+	}
+	return s.Metadata(key, normalizeValue(v))
+}
+
 // Set the current rule message
 func (s *State) Message(message string) *State {
 	r := s.headRule()
@@ -268,6 +766,7 @@ func (s *State) Message(message string) *State {
 func (s *State) Fix(fix string) *State {
 	r := s.headRule()
 	r.Fix = fix
+	r.fixOrigin = s.origin
 	return s
 }
 
@@ -282,6 +781,28 @@ func (s *State) FixRegex(fixRegex string) *State {
 func (s *State) ID(id string) *State {
 	r := s.headRule()
 	r.Id = id
+	r.idOrigin = s.origin
+	r.generatedID = false
+	return s
+}
+
+// Set the minimum engine version required by the current rule.
+func (s *State) MinVersion(version string) *State {
+	r := s.headRule()
+	if _, ok := parseVersion(version); !ok {
+		s.warn(fmt.Sprintf("invalid min-version '%s'", version))
+	}
+	r.MinVersion = version
+	return s
+}
+
+// Set the maximum engine version supported by the current rule.
+func (s *State) MaxVersion(version string) *State {
+	r := s.headRule()
+	if _, ok := parseVersion(version); !ok {
+		s.warn(fmt.Sprintf("invalid max-version '%s'", version))
+	}
+	r.MaxVersion = version
 	return s
 }
 
@@ -290,8 +811,8 @@ func (s *State) Severity(severity string) *State {
 	r := s.headRule()
 	severity = strings.ToUpper(severity)
 	if _, ok := severities[severity]; !ok {
+		s.warn(fmt.Sprintf("unknown severity '%s', using default '%s'", severity, SEVERITY_WARNING)).Hint = hintOneOf(severity, keys(severities))
 		severity = SEVERITY_WARNING
-		s.warn(fmt.Sprintf("unknown severity '%s', using default '%s'", severity, SEVERITY_WARNING))
 	}
 	r.Severity = severity
 	return s
@@ -321,10 +842,54 @@ func (s *State) Command(path string) *State {
 	return s
 }
 
-// Set an option for the current rule.
+// Set the language of the rules created next given no language, instead of
+// generic.
+func (s *State) DefaultLanguage(lang string) *State {
+	s.language = lang
+	return s
+}
+
+// Exclude a path or pattern from the scan of all the rules.
+func (s *State) Exclude(pattern string) *State {
+	s.excludes = append(s.excludes, pattern)
+	return s
+}
+
+// Pass additional arguments to the engine.
+func (s *State) EngineArgs(args ...string) *State {
+	s.engineArgs = append(s.engineArgs, args...)
+	return s
+}
+
+// Set an option for the current rule, converting the value to the type of
+// the option.
 func (s *State) Option(name string, value string) *State {
 	h := s.headRule()
-	h.Options[name] = value
+	if h.Options == nil {
+		h.Options = map[string]any{}
+	}
+
+	option, ok := LookupOption(name)
+	if !ok {
+		names := []string{}
+		for _, option := range Options {
+			names = append(names, option.Name)
+		}
+		d := s.warn(fmt.Sprintf("unknown rule option '%s'", name))
+		if closest := Closest(name, names); closest != "" {
+			d.Hint = fmt.Sprintf("did you mean %s?", closest)
+		}
+		h.Options[name] = value
+		return s
+	}
+
+	v, err := option.Parse(value)
+	if err != nil {
+		s.warn(fmt.Sprintf("invalid value '%s' for %s option '%s'", value, option.Type, name))
+		h.Options[name] = value
+		return s
+	}
+	h.Options[name] = v
 	return s
 }
 
@@ -354,8 +919,26 @@ func (s *State) Verbose() *State {
 	return s
 }
 
+// Convert the maps decoded by yaml to string keyed maps.
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeValue(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeValue(item)
+		}
+		return v
+	}
+	return value
+}
+
 func normalizeMetavariable(value string) string {
-	if value[0] != '$' {
+	if !strings.HasPrefix(value, "$") {
 		return "$" + value
 	}
 
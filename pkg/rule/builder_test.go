@@ -4,8 +4,16 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func marshal(t *testing.T, state *State) string {
+	t.Helper()
+	y, err := state.MarshalRules()
+	require.NoError(t, err)
+	return string(y)
+}
+
 const expected = `rules:
 - id: rule-1
   severity: INFO
@@ -14,7 +22,7 @@ const expected = `rules:
   - go
   - generic
   options:
-    generic_ellipsis_max_span: "5"
+    generic_ellipsis_max_span: 5
   patterns:
   - focus-metavariable: $PKG
   - pattern-either:
@@ -84,5 +92,506 @@ func TestBuilder(t *testing.T) {
 		PathInclude("path/to/includetoo").
 		PathExclude("path/to/exclude")
 
-	assert.Equal(t, expected, string(state.MarshalRules()))
+	assert.Equal(t, expected, marshal(t, state))
+}
+
+func TestMetavariableComparison(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("python").
+		Pattern("bind($PORT)").
+		MetavariableComparison("$PORT < 1024").
+		Pattern("os.chmod($PATH, $MODE)").
+		ComparisonStrip().
+		MetavariableComparison("$MODE > 644").
+		ComparisonMetavariable("$MODE").
+		ComparisonBase("8").
+		ComparisonBase("x").
+		ComparisonStrip()
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  patterns:
+  - pattern: bind($PORT)
+  - metavariable-comparison:
+      comparison: $PORT < 1024
+  - pattern: os.chmod($PATH, $MODE)
+  - metavariable-comparison:
+      metavariable: $MODE
+      comparison: $MODE > 644
+      base: 8
+      strip: true
+`, marshal(t, state))
+	messages := []string{}
+	for _, warning := range state.Warnings() {
+		messages = append(messages, warning.Message)
+	}
+	assert.Equal(t, []string{
+		"no metavariable comparison to set 'strip' on",
+		"invalid comparison base 'x', expected an integer from 2 to 36",
+	}, messages)
+}
+
+func TestTaintSanitizersAndPropagators(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("python").
+		PatternSources().
+		Pattern("source()").
+		PatternSinks().
+		Pattern("sink(...)").
+		PatternSanitizers().
+		Pattern("clean(...)").
+		PatternPropagators().
+		PropagateFrom("FROM").
+		PropagateTo("TO").
+		Pattern("$TO.append($FROM)")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  mode: taint
+  pattern-sources:
+  - pattern: source()
+  pattern-sinks:
+  - pattern: sink(...)
+  pattern-sanitizers:
+  - pattern: clean(...)
+  pattern-propagators:
+  - pattern: $TO.append($FROM)
+    from: $FROM
+    to: $TO
+`, marshal(t, state))
+}
+
+func TestTaintLabels(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("python").
+		PatternSources().
+		Label("USER").
+		Pattern("input()").
+		Pattern("request.args").
+		PatternSources().
+		Label("SECRET").
+		BySideEffect("only").
+		Pattern("secret()").
+		PatternSinks().
+		Requires("USER and not SECRET").
+		Exact("false").
+		Pattern("exec(...)")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  mode: taint
+  pattern-sources:
+  - pattern: input()
+    label: USER
+  - pattern: request.args
+    label: USER
+  - pattern: secret()
+    label: SECRET
+    by-side-effect: only
+  pattern-sinks:
+  - pattern: exec(...)
+    requires: USER and not SECRET
+    exact: false
+`, marshal(t, state))
+	assert.Empty(t, state.warnings)
+}
+
+func TestMetavariableAnalysis(t *testing.T) {
+	state := Builder().
+		Rule().
+		PatternRegex(`(?<SECRET>[A-Za-z0-9]{32})`).
+		MetavariableAnalysis("SECRET", "entropy")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - generic
+  patterns:
+  - pattern-regex: (?<SECRET>[A-Za-z0-9]{32})
+  - metavariable-analysis:
+      metavariable: $SECRET
+      analyzer: entropy
+`, marshal(t, state))
+	assert.Empty(t, state.warnings)
+
+	state.MetavariableAnalysis("SECRET", "magic")
+	assert.Len(t, state.warnings, 1)
+	assert.Len(t, *state.rules[0].Patterns, 2)
+	assert.NotContains(t, marshal(t, state), "magic")
+}
+
+func TestJoin(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("python").
+		ID("route").
+		Pattern("@app.route(...)\ndef $F(...): ...").
+		Rule().
+		ID("render").
+		Pattern("render_template_string(...)").
+		PatternInside("def $F(...): ...").
+		Join().
+		On("route.$F == render.$F")
+
+	assert.Equal(t, `rules:
+- id: rule-3
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  mode: join
+  join:
+    rules:
+    - id: route
+      severity: WARNING
+      message: ""
+      languages:
+      - python
+      patterns:
+      - pattern: |-
+          @app.route(...)
+          def $F(...): ...
+    - id: render
+      severity: WARNING
+      message: ""
+      languages:
+      - python
+      patterns:
+      - pattern: render_template_string(...)
+      - pattern-inside: 'def $F(...): ...'
+    "on":
+    - route.$F == render.$F
+`, marshal(t, state))
+}
+
+func TestRuleAfterJoin(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("a($X)").
+		Join().
+		On("rule-1.$X == rule-1.$X").
+		Rule().
+		Pattern("b")
+
+	ids := []string{}
+	for _, r := range state.Rules() {
+		ids = append(ids, r.Id)
+	}
+	assert.Equal(t, []string{"rule-2", "rule-3"}, ids)
+	assert.Empty(t, validationErrors(t, state))
+}
+
+func TestJoinRejectsPatterns(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("foo($X)").
+		Join().
+		At(3, "-pi").
+		PatternInside("bar($X)")
+
+	err := state.Err()
+	var d *Diagnostic
+	if assert.ErrorAs(t, err, &d) {
+		assert.Equal(t, "pattern added to a join rule", d.Message)
+		assert.Equal(t, "add the pattern to a rule before --join", d.Hint)
+		assert.Equal(t, Origin{Index: 3, Flag: "-pi"}, d.Origin)
+	}
+	assert.Empty(t, *state.rules[0].Patterns)
+}
+
+func TestExtract(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("yaml").
+		Pattern("run: $CMD").
+		Extract("CMD").
+		DestLanguage("bash").
+		DestRules("curl-pipe-sh").
+		Reduce("concat").
+		Reduce("join").
+		Rule().
+		ID("curl-pipe-sh").
+		Pattern("curl ... | sh")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - yaml
+  mode: extract
+  patterns:
+  - pattern: 'run: $CMD'
+  extract: $CMD
+  dest-language: bash
+  dest-rules:
+  - curl-pipe-sh
+  reduce: concat
+- id: curl-pipe-sh
+  severity: WARNING
+  message: ""
+  languages:
+  - bash
+  patterns:
+  - pattern: curl ... | sh
+`, marshal(t, state))
+	if warnings := state.Warnings(); assert.Len(t, warnings, 1) {
+		assert.Equal(t, "unknown reduce 'join', expected concat or separate", warnings[0].Message)
+	}
+}
+
+func TestMetavariablePatternLanguage(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("yaml").
+		Pattern("run: $CMD").
+		MetavariablePatternWithLanguage("CMD", "bash").
+		Pattern("curl ... | sh")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - yaml
+  patterns:
+  - pattern: 'run: $CMD'
+  - metavariable-pattern:
+      metavariable: $CMD
+      language: bash
+      patterns:
+      - pattern: curl ... | sh
+`, marshal(t, state))
+}
+
+func TestMetavariablePatternRegex(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("python").
+		Pattern("requests.get($URL)").
+		MetavariablePatternRegex("URL", "^http://").
+		Pattern("$X")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  patterns:
+  - pattern: requests.get($URL)
+  - metavariable-pattern:
+      metavariable: $URL
+      pattern-regex: ^http://
+  - pattern: $X
+`, marshal(t, state))
+}
+
+func TestMetavariableTypeAndName(t *testing.T) {
+	state := Builder().
+		Rule().
+		Language("go").
+		Pattern("$F.Close()").
+		MetavariableType("F", "*os.File").
+		MetavariableName("F", "os")
+
+	assert.Equal(t, `rules:
+- id: rule-1
+  severity: WARNING
+  message: ""
+  languages:
+  - go
+  patterns:
+  - pattern: $F.Close()
+  - metavariable-type:
+      metavariable: $F
+      type: '*os.File'
+  - metavariable-name:
+      metavariable: $F
+      module: os
+`, marshal(t, state))
+}
+
+func TestFillVersions(t *testing.T) {
+	state := Builder().
+		Command("/usr/local/bin/semgrep").
+		Rule().
+		PatternSources().
+		Label("USER").
+		Pattern("input()").
+		PatternSinks().
+		Pattern("exec(...)").
+		MetavariableComparison("$X > 1").
+		Rule().
+		Pattern("foo()").
+		Rule().
+		Pattern("bar($X)").
+		MetavariableComparison("$X > 1").
+		MinVersion("1.0.0")
+
+	state.fillVersions()
+
+	assert.Equal(t, "0.95.0", state.rules[0].MinVersion)
+	assert.Equal(t, "", state.rules[1].MinVersion)
+	assert.Equal(t, "1.0.0", state.rules[2].MinVersion)
+	assert.Empty(t, state.warnings)
+
+	// Opengrep supports all the features since its first release
+	state = Builder().
+		Rule().
+		Pattern("bar($X)").
+		MetavariableComparison("$X > 1")
+
+	state.fillVersions()
+
+	assert.Equal(t, "", state.rules[0].MinVersion)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Negative(t, compareVersions("1.2.0", "1.10"))
+	assert.Negative(t, compareVersions("0.95.0", "1.0"))
+	assert.Zero(t, compareVersions("v1.2", "1.2"))
+	assert.Positive(t, compareVersions("0.1.0", ""))
+}
+
+func TestMetadata(t *testing.T) {
+	state := Builder().
+		Rule().
+		Metadata("cwe", "CWE-79").
+		Metadata("cwe", "CWE-80").
+		Metadata("owasp.category", "A01").
+		MetadataValue("confidence", "0.9").
+		MetadataValue("references", `["https://a", "https://b"]`).
+		MetadataValue("references", `https://c`).
+		MetadataValue("extra", `{"nested": {"key": true}}`).
+		Metadata("tags", "web").
+		MetadataValue("tags", `[injection, xss]`)
+
+	assert.Equal(t, map[string]any{
+		"cwe":        []any{"CWE-79", "CWE-80"},
+		"owasp":      map[string]any{"category": "A01"},
+		"confidence": 0.9,
+		"references": []any{"https://a", "https://b", "https://c"},
+		"extra":      map[string]any{"nested": map[string]any{"key": true}},
+		"tags":       []any{"web", "injection", "xss"},
+	}, state.headRule().Metadata)
+	assert.Empty(t, state.warnings)
+
+	state.Metadata("owasp.category.name", "broken")
+	state.MetadataValue("extra", `{"other": 1}`)
+	assert.Equal(t, map[string]any{"nested": map[string]any{"key": true}}, state.headRule().Metadata["extra"])
+	messages := []string{}
+	for _, warning := range state.warnings {
+		messages = append(messages, warning.Message)
+	}
+	assert.Equal(t, []string{
+		"metadata key 'category' is not a map, cannot set 'owasp.category.name'",
+		"metadata key 'extra' is a map, cannot add a value to it",
+	}, messages)
+}
+
+func TestOptionTypes(t *testing.T) {
+	state := Builder().
+		Rule().
+		Option("symbolic_propagation", "true").
+		Option("generic_ellipsis_max_span", "5").
+		Option("generic_extra_word_characters", "-,.").
+		Option("generic_engine", "aliengrep")
+
+	assert.Equal(t, map[string]any{
+		"symbolic_propagation":          true,
+		"generic_ellipsis_max_span":     5,
+		"generic_extra_word_characters": []string{"-", "."},
+		"generic_engine":                "aliengrep",
+	}, state.headRule().Options)
+	assert.Empty(t, state.warnings)
+
+	state.Option("unknown_option", "1").Option("interfile", "maybe")
+	assert.Len(t, state.warnings, 2)
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"generic_ellipsis_max_span", "symbolic_propagation", "taint_unify_mvars"}
+	assert.Equal(t, "symbolic_propagation", Closest("symbolic_propagaton", candidates))
+	assert.Equal(t, "", Closest("constant_propagation", candidates))
+}
+
+func TestTree(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("foo($X)").
+		PatternEither().
+		Pattern("$X == 1").
+		Pattern("$X == 2").
+		Pop().
+		MetavariablePatternWithLanguage("X", "python").
+		PatternRegex("^a").
+		Rule().
+		PatternSources().
+		Label("USER").
+		BySideEffect("true").
+		Pattern("input()").
+		PatternSinks().
+		Requires("USER").
+		Pattern("exec(...)")
+
+	expected := `rule-1
+└─ patterns
+   ├─ pattern: foo($X)
+   ├─ pattern-either
+   │  ├─ pattern: $X == 1
+   │  └─ pattern: $X == 2
+   └─ metavariable-pattern $X:python
+      └─ pattern-regex: ^a
+rule-2
+├─ pattern-sources (label: USER, by-side-effect: true)
+│  └─ pattern: input()
+└─ pattern-sinks (requires: USER)
+   └─ pattern: exec(...)
+`
+	assert.Equal(t, expected, state.Tree())
+	assert.Equal(t, 0, state.Depth())
+}
+
+func TestTreeJoin(t *testing.T) {
+	state := Builder().
+		Rule().
+		ID("route").
+		Pattern("route($F)").
+		Rule().
+		ID("render").
+		Pattern("render($F)").
+		Join().
+		JoinRef("rules/sink.yaml", "sink").
+		On("route.$F == render.$F")
+
+	expected := `rule-3
+└─ join
+   ├─ route
+   │  └─ patterns
+   │     └─ pattern: route($F)
+   ├─ render
+   │  └─ patterns
+   │     └─ pattern: render($F)
+   ├─ ref: rules/sink.yaml as sink
+   └─ on: route.$F == render.$F
+`
+	assert.Equal(t, expected, state.Tree())
 }
@@ -0,0 +1,42 @@
+package rule
+
+import (
+	"slices"
+	"strings"
+)
+
+// Names of the metavariables bound by the patterns of the current rule,
+// without the leading $.
+func (s *State) Metavariables() []string {
+	names := []string{}
+	for metavariable := range s.headRule().boundMetavariables() {
+		names = append(names, strings.TrimPrefix(metavariable, "$"))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Section of the taint group receiving the taint options, empty outside of a
+// taint group.
+func (s *State) TaintSection() string {
+	if s.taint == nil {
+		return ""
+	}
+	return s.taintSection
+}
+
+// Whether a pattern propagator group receives the from/to metavariables.
+func (s *State) InPropagator() bool {
+	return s.propagator != nil
+}
+
+// Whether the last pattern of the current pattern group is a metavariable
+// comparison receiving the comparison options.
+func (s *State) InComparison() bool {
+	return s.lastComparison() != nil
+}
+
+// Whether the current rule is a join rule.
+func (s *State) InJoin() bool {
+	return s.headRule().Join != nil
+}
@@ -0,0 +1,119 @@
+package rule
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type DiagnosticSeverity string
+
+const (
+	DIAGNOSTIC_ERROR   DiagnosticSeverity = "error"
+	DIAGNOSTIC_WARNING DiagnosticSeverity = "warning"
+)
+
+// Command line argument that produced part of a rule. The zero value is used
+// for rules that do not come from the command line.
+type Origin struct {
+	// index of the argument
+	Index int
+	// flag as written on the command line
+	Flag string
+}
+
+func (o Origin) String() string {
+	if o.Flag == "" {
+		return ""
+	}
+	return fmt.Sprintf("argument %d: %s", o.Index+1, o.Flag)
+}
+
+// Problem found while building or checking the rules.
+type Diagnostic struct {
+	Origin
+	Severity DiagnosticSeverity
+	// ID of the rule the problem is in, empty when not about a rule
+	Rule    string
+	Message string
+	// suggestion to fix the problem
+	Hint string
+}
+
+func (d *Diagnostic) Error() string {
+	message := d.Message
+	if d.Rule != "" {
+		message = fmt.Sprintf("%s: %s", d.Rule, message)
+	}
+	if d.Flag != "" {
+		message = fmt.Sprintf("%s (%s)", message, d.Origin)
+	}
+	return message
+}
+
+func (s *State) diagnostic(severity DiagnosticSeverity, message string) *Diagnostic {
+	d := &Diagnostic{
+		Origin:   s.origin,
+		Severity: severity,
+		Message:  message,
+	}
+	if len(s.rules) > 0 {
+		d.Rule = s.headRule().Id
+	}
+	return d
+}
+
+// Return the warnings found while building the rules.
+func (s *State) Warnings() []*Diagnostic {
+	return s.warnings
+}
+
+// Return the candidate closest to the word, empty when none is close enough
+// to be a likely typo.
+func Closest(word string, candidates []string) string {
+	best, bestDistance := "", len(word)/3+1
+	for _, candidate := range candidates {
+		if d := distance(word, candidate); d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// Levenshtein distance between two strings.
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Hint listing the accepted values, suggesting the closest one.
+func hintOneOf(value string, values []string) string {
+	slices.Sort(values)
+	if closest := Closest(value, values); closest != "" {
+		return fmt.Sprintf("did you mean %s?", closest)
+	}
+	return fmt.Sprintf("expected one of: %s", strings.Join(values, ", "))
+}
+
+func keys(m map[string]bool) []string {
+	values := []string{}
+	for k := range m {
+		values = append(values, k)
+	}
+	return values
+}
@@ -0,0 +1,425 @@
+package rule
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Top-level keys of a rule that are decoded into the Rule fields.
+var ruleKeys = map[string]bool{
+	// keep-sorted start
+	"dest-language":       true,
+	"dest-rules":          true,
+	"extract":             true,
+	"fix":                 true,
+	"fix-regex":           true,
+	"id":                  true,
+	"join":                true,
+	"languages":           true,
+	"max-version":         true,
+	"message":             true,
+	"metadata":            true,
+	"min-version":         true,
+	"mode":                true,
+	"options":             true,
+	"paths":               true,
+	"pattern":             true,
+	"pattern-either":      true,
+	"pattern-propagators": true,
+	"pattern-regex":       true,
+	"pattern-sanitizers":  true,
+	"pattern-sinks":       true,
+	"pattern-sources":     true,
+	"patterns":            true,
+	"reduce":              true,
+	"severity":            true,
+	"transform":           true,
+	// keep-sorted end
+}
+
+type ruleYAML struct {
+	Id         string         `yaml:"id"`
+	Severity   string         `yaml:"severity"`
+	Message    string         `yaml:"message"`
+	Languages  []string       `yaml:"languages"`
+	MinVersion string         `yaml:"min-version"`
+	MaxVersion string         `yaml:"max-version"`
+	Mode       string         `yaml:"mode"`
+	Fix        string         `yaml:"fix"`
+	FixRegex   *fixRegexYAML  `yaml:"fix-regex"`
+	Options    map[string]any `yaml:"options"`
+	Metadata   map[string]any `yaml:"metadata"`
+	Paths      *RulePaths     `yaml:"paths"`
+
+	Pattern       string     `yaml:"pattern"`
+	PatternRegex  string     `yaml:"pattern-regex"`
+	PatternEither *[]Pattern `yaml:"pattern-either"`
+	Patterns      *[]Pattern `yaml:"patterns"`
+
+	PatternSources     []taintItem      `yaml:"pattern-sources"`
+	PatternSinks       []taintItem      `yaml:"pattern-sinks"`
+	PatternSanitizers  []taintItem      `yaml:"pattern-sanitizers"`
+	PatternPropagators []propagatorItem `yaml:"pattern-propagators"`
+
+	Join *RuleJoin `yaml:"join"`
+
+	Extract      string   `yaml:"extract"`
+	DestLanguage string   `yaml:"dest-language"`
+	DestRules    []string `yaml:"dest-rules"`
+	Transform    string   `yaml:"transform"`
+	Reduce       string   `yaml:"reduce"`
+}
+
+type fixRegexYAML struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+	Count       int    `yaml:"count"`
+}
+
+func (r *Rule) UnmarshalYAML(unmarshal func(any) error) error {
+	var keys yaml.MapSlice
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+
+	var raw ruleYAML
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*r = Rule{
+		Id:         raw.Id,
+		Severity:   raw.Severity,
+		Message:    raw.Message,
+		Languages:  raw.Languages,
+		MinVersion: raw.MinVersion,
+		MaxVersion: raw.MaxVersion,
+		Fix:        raw.Fix,
+		Options:    normalizeMap(raw.Options),
+		Metadata:   normalizeMap(raw.Metadata),
+		Paths:      raw.Paths,
+		Join:       raw.Join,
+
+		Extract:      raw.Extract,
+		DestLanguage: raw.DestLanguage,
+		DestRules:    raw.DestRules,
+		Transform:    raw.Transform,
+		Reduce:       raw.Reduce,
+
+		loaded: true,
+	}
+
+	if raw.FixRegex != nil {
+		r.FixRegex = raw.FixRegex.Regex
+		r.Fix = raw.FixRegex.Replacement
+		r.FixCount = raw.FixRegex.Count
+	}
+
+	switch {
+	case raw.Patterns != nil:
+		r.Patterns = raw.Patterns
+	case raw.Pattern != "":
+		r.Patterns = &[]Pattern{{Pattern: raw.Pattern}}
+		r.formula = "pattern"
+	case raw.PatternRegex != "":
+		r.Patterns = &[]Pattern{{PatternRegex: raw.PatternRegex}}
+		r.formula = "pattern-regex"
+	case raw.PatternEither != nil:
+		r.Patterns = &[]Pattern{{PatternEither: raw.PatternEither}}
+		r.formula = "pattern-either"
+	default:
+		r.Patterns = &[]Pattern{}
+	}
+
+	r.PatternSources = taintSpecs(raw.PatternSources)
+	r.PatternSinks = taintSpecs(raw.PatternSinks)
+	r.PatternSanitizers = taintSpecs(raw.PatternSanitizers)
+	if raw.PatternPropagators != nil {
+		propagators := []PatternPropagator{}
+		for _, item := range raw.PatternPropagators {
+			propagators = append(propagators, PatternPropagator{
+				Patterns: &[]Pattern{item.Pattern},
+				From:     item.From,
+				To:       item.To,
+			})
+		}
+		r.PatternPropagators = &propagators
+	}
+
+	for _, item := range keys {
+		if key, ok := item.Key.(string); !ok || !ruleKeys[key] {
+			r.Extra = append(r.Extra, item)
+		}
+	}
+
+	return nil
+}
+
+// Split the flattened taint entries back into one group per entry.
+func taintSpecs(items []taintItem) *[]TaintSpec {
+	if items == nil {
+		return nil
+	}
+	specs := []TaintSpec{}
+	for _, item := range items {
+		spec := TaintSpec{
+			Patterns: &[]Pattern{item.Pattern},
+			Label:    item.Label,
+			Requires: item.Requires,
+			Exact:    item.Exact,
+			Control:  item.Control,
+		}
+		if item.BySideEffect != nil {
+			spec.BySideEffect = fmt.Sprint(item.BySideEffect)
+		}
+		specs = append(specs, spec)
+	}
+	return &specs
+}
+
+func (p *Pattern) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := checkKeys(unmarshal, Pattern{}); err != nil {
+		return err
+	}
+	type plain Pattern
+	return unmarshal((*plain)(p))
+}
+
+// The inline pattern would otherwise reject the taint keys, so the pattern
+// and the taint keys are decoded separately.
+func (t *taintItem) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := checkKeys(unmarshal, taintItem{}); err != nil {
+		return err
+	}
+	var attributes struct {
+		Label        string `yaml:"label"`
+		Requires     string `yaml:"requires"`
+		BySideEffect any    `yaml:"by-side-effect"`
+		Exact        *bool  `yaml:"exact"`
+		Control      bool   `yaml:"control"`
+	}
+	if err := unmarshal(&attributes); err != nil {
+		return err
+	}
+	*t = taintItem{
+		Label:        attributes.Label,
+		Requires:     attributes.Requires,
+		BySideEffect: attributes.BySideEffect,
+		Exact:        attributes.Exact,
+		Control:      attributes.Control,
+	}
+	type plain Pattern
+	return unmarshal((*plain)(&t.Pattern))
+}
+
+func (p *propagatorItem) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := checkKeys(unmarshal, propagatorItem{}); err != nil {
+		return err
+	}
+	var attributes struct {
+		From string `yaml:"from"`
+		To   string `yaml:"to"`
+	}
+	if err := unmarshal(&attributes); err != nil {
+		return err
+	}
+	*p = propagatorItem{From: attributes.From, To: attributes.To}
+	type plain Pattern
+	return unmarshal((*plain)(&p.Pattern))
+}
+
+// The nested mappings of the rules reject the keys they would drop, since
+// they have no place to keep them.
+
+func (m *MetavariableRegex) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariableRegex
+	return unmarshalKnown(unmarshal, "metavariable-regex", (*plain)(m))
+}
+
+func (m *MetavariableComparison) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariableComparison
+	return unmarshalKnown(unmarshal, "metavariable-comparison", (*plain)(m))
+}
+
+func (m *MetavariableAnalysis) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariableAnalysis
+	return unmarshalKnown(unmarshal, "metavariable-analysis", (*plain)(m))
+}
+
+func (m *MetavariableType) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariableType
+	return unmarshalKnown(unmarshal, "metavariable-type", (*plain)(m))
+}
+
+func (m *MetavariableName) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariableName
+	return unmarshalKnown(unmarshal, "metavariable-name", (*plain)(m))
+}
+
+func (m *MetavariablePattern) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain MetavariablePattern
+	return unmarshalKnown(unmarshal, "metavariable-pattern", (*plain)(m))
+}
+
+func (j *RuleJoin) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain RuleJoin
+	return unmarshalKnown(unmarshal, "join", (*plain)(j))
+}
+
+func (j *JoinRef) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain JoinRef
+	return unmarshalKnown(unmarshal, "join refs", (*plain)(j))
+}
+
+func (p *RulePaths) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain RulePaths
+	return unmarshalKnown(unmarshal, "paths", (*plain)(p))
+}
+
+func (f *fixRegexYAML) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain fixRegexYAML
+	return unmarshalKnown(unmarshal, "fix-regex", (*plain)(f))
+}
+
+// Decode a mapping of the section into the pointer v after checking its keys.
+func unmarshalKnown(unmarshal func(any) error, section string, v any) error {
+	if err := checkKeys(unmarshal, reflect.ValueOf(v).Elem().Interface()); err != nil {
+		return fmt.Errorf("%w in %s", err, section)
+	}
+	return unmarshal(v)
+}
+
+// Report the keys of a mapping that the fields of v do not decode.
+func checkKeys(unmarshal func(any) error, v any) error {
+	var keys yaml.MapSlice
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	known := yamlKeys(reflect.TypeOf(v))
+	for _, item := range keys {
+		if key := fmt.Sprint(item.Key); !known[key] {
+			return fmt.Errorf("unsupported key '%s'", key)
+		}
+	}
+	return nil
+}
+
+func yamlKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, flags, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case flags == "inline":
+			for key := range yamlKeys(field.Type) {
+				keys[key] = true
+			}
+		case name != "" && name != "-":
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+func normalizeMap(m map[string]any) map[string]any {
+	for key, value := range m {
+		m[key] = normalizeValue(value)
+	}
+	return m
+}
+
+// Parse the rules of a rule file. Rules written by semsearch are marshalled
+// back to the same YAML, other rules get the key order and defaults of
+// semsearch.
+func ParseRules(data []byte) ([]*Rule, error) {
+	var file struct {
+		Rules []*Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if err := checkEmpty(file.Rules, ""); err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+// Report the null entries of a rule list, such as "- " with no rule.
+func checkEmpty(rules []*Rule, parent string) error {
+	for i, r := range rules {
+		switch {
+		case r == nil && parent != "":
+			return fmt.Errorf("rule %d of the join rule %s is empty", i+1, parent)
+		case r == nil:
+			return fmt.Errorf("rule %d is empty", i+1)
+		case r.Join != nil:
+			if err := checkEmpty(r.Join.Rules, r.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Load the rules of a rule file in the state. The flags following it modify
+// the last loaded rule.
+func (s *State) Load(path string) *State {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.fail(s.diagnostic(DIAGNOSTIC_ERROR, fmt.Sprintf("failed to read rules: %v", err)))
+		return s
+	}
+
+	rules, err := ParseRules(data)
+	if err != nil {
+		s.fail(s.diagnostic(DIAGNOSTIC_ERROR, fmt.Sprintf("failed to parse rules in %s: %v", path, err)))
+		return s
+	}
+
+	return s.AddRules(rules...)
+}
+
+// Add rules to the state. The initial rule is replaced when nothing was
+// added to it.
+func (s *State) AddRules(rules ...*Rule) *State {
+	if len(rules) == 0 {
+		return s
+	}
+
+	if len(s.rules) == 1 && s.rules[0].untouched() {
+		s.rules = nil
+	}
+	s.rules = append(s.rules, rules...)
+	s.count += len(rules)
+
+	r := s.headRule()
+	s.taint = nil
+	s.propagator = nil
+	switch {
+	case r.PatternSinks != nil && len(*r.PatternSinks) > 0:
+		s.taint = &(*r.PatternSinks)[len(*r.PatternSinks)-1]
+		s.taintSection = TAINT_SINKS
+		s.stack = []*[]Pattern{s.taint.Patterns}
+	default:
+		if r.Patterns == nil {
+			r.Patterns = &[]Pattern{}
+		}
+		s.stack = []*[]Pattern{r.Patterns}
+	}
+	return s
+}
+
+// Whether the rule is still as created by State.Rule.
+func (r *Rule) untouched() bool {
+	return (r.Patterns == nil || len(*r.Patterns) == 0) &&
+		r.PatternSources == nil && r.PatternSinks == nil &&
+		r.PatternSanitizers == nil && r.PatternPropagators == nil &&
+		r.Join == nil && r.Extract == "" &&
+		r.Message == "" && r.Fix == "" && r.FixRegex == "" &&
+		(len(r.Languages) == 0 || r.defaultLanguage) && len(r.Metadata) == 0 &&
+		len(r.Options) == 0 && r.Paths == nil
+}
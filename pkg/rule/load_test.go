@@ -0,0 +1,142 @@
+package rule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRoundTrip(t *testing.T) {
+	rules, err := ParseRules([]byte(expected))
+	require.NoError(t, err)
+
+	state := Builder().Rule().AddRules(rules...)
+
+	assert.Equal(t, expected, marshal(t, state))
+}
+
+func TestLoadThenModify(t *testing.T) {
+	rules, err := ParseRules([]byte(`rules:
+- id: flask-xss
+  severity: ERROR
+  message: unsafe template
+  languages:
+  - python
+  pattern: render_template_string($X)
+  custom: kept
+`))
+	require.NoError(t, err)
+
+	state := Builder().Rule().AddRules(rules...)
+	assert.Equal(t, `rules:
+- id: flask-xss
+  severity: ERROR
+  message: unsafe template
+  languages:
+  - python
+  pattern: render_template_string($X)
+  custom: kept
+`, marshal(t, state))
+
+	state.PatternNotInside("def test_$F(...): ...")
+	assert.Equal(t, `rules:
+- id: flask-xss
+  severity: ERROR
+  message: unsafe template
+  languages:
+  - python
+  patterns:
+  - pattern: render_template_string($X)
+  - pattern-not-inside: 'def test_$F(...): ...'
+  custom: kept
+`, marshal(t, state))
+}
+
+func TestLoadUnsupportedPatternKey(t *testing.T) {
+	_, err := ParseRules([]byte(`rules:
+- id: bad
+  patterns:
+  - pattern-maybe: foo
+`))
+	assert.ErrorContains(t, err, "unsupported key 'pattern-maybe'")
+}
+
+func TestLoadNestedRoundTrip(t *testing.T) {
+	yaml := `rules:
+- id: nested
+  severity: WARNING
+  message: ""
+  languages:
+  - python
+  paths:
+    include:
+    - src
+  patterns:
+  - pattern: f($X, $Y)
+  - metavariable-regex:
+      metavariable: $X
+      regex: ^a
+  - metavariable-comparison:
+      metavariable: $Y
+      comparison: $Y > 10
+      base: 16
+      strip: true
+  - metavariable-analysis:
+      metavariable: $X
+      analyzer: entropy
+  - metavariable-type:
+      metavariable: $Y
+      type: int
+  - metavariable-name:
+      metavariable: $X
+      module: os
+  - metavariable-pattern:
+      metavariable: $X
+      language: bash
+      patterns:
+      - pattern: rm -rf
+`
+	rules, err := ParseRules([]byte(yaml))
+	require.NoError(t, err)
+
+	state := Builder().Rule().AddRules(rules...)
+	assert.Equal(t, yaml, marshal(t, state))
+}
+
+func TestLoadUnsupportedNestedKey(t *testing.T) {
+	tests := []struct {
+		yaml    string
+		message string
+	}{
+		{"patterns:\n  - metavariable-regex: {metavariable: $X, regex: a, constant-propagation: true}",
+			"unsupported key 'constant-propagation' in metavariable-regex"},
+		{"patterns:\n  - metavariable-comparison: {comparison: $X > 1, round: true}",
+			"unsupported key 'round' in metavariable-comparison"},
+		{"patterns:\n  - metavariable-pattern: {metavariable: $X, pattern: a}",
+			"unsupported key 'pattern' in metavariable-pattern"},
+		{"pattern: a\n  paths: {include: [src], only: [lib]}",
+			"unsupported key 'only' in paths"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseRules([]byte("rules:\n- id: bad\n  " + test.yaml + "\n"))
+		assert.ErrorContains(t, err, test.message, test.yaml)
+	}
+}
+
+func TestLoadEmptyRule(t *testing.T) {
+	_, err := ParseRules([]byte("rules:\n- id: first\n  pattern: a\n- \n"))
+	assert.EqualError(t, err, "rule 2 is empty")
+
+	_, err = ParseRules([]byte("rules:\n- id: both\n  join:\n    rules:\n    -\n"))
+	assert.EqualError(t, err, "rule 1 of the join rule both is empty")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "n.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n- \n"), 0644))
+	state := Builder().Rule().Load(path)
+	assert.ErrorContains(t, state.Err(), "failed to parse rules in "+path+": rule 1 is empty")
+}
@@ -0,0 +1,84 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	OPTION_BOOL   = "bool"
+	OPTION_INT    = "int"
+	OPTION_STRING = "string"
+	OPTION_LIST   = "list"
+)
+
+// Rule option understood by the engines.
+type OptionSpec struct {
+	Name        string
+	Type        string
+	Default     any
+	Description string
+}
+
+// Known rule options and their types.
+var Options = []OptionSpec{
+	// keep-sorted start
+	{"ac_matching", OPTION_BOOL, true, "Match associative and commutative operators in any order"},
+	{"arrow_is_function", OPTION_BOOL, true, "Match arrow functions with function patterns"},
+	{"attr_expr", OPTION_BOOL, true, "Match attribute expressions with expression patterns"},
+	{"commutative_boolop", OPTION_BOOL, false, "Treat boolean operators as commutative"},
+	{"constant_propagation", OPTION_BOOL, true, "Match constant values through variables"},
+	{"decorators_order_matters", OPTION_BOOL, false, "Match decorators in the order of the pattern"},
+	{"flddef_assign", OPTION_BOOL, false, "Match field definitions with assignment patterns"},
+	{"generic_caseless", OPTION_BOOL, false, "Match case-insensitively in generic mode"},
+	{"generic_comment_style", OPTION_STRING, nil, "Ignore comments of this style in generic mode (c, cpp, shell)"},
+	{"generic_ellipsis_max_span", OPTION_INT, 10, "Maximum number of lines an ellipsis matches in generic mode"},
+	{"generic_engine", OPTION_STRING, "spacegrep", "Generic mode engine (spacegrep, aliengrep)"},
+	{"generic_extra_word_characters", OPTION_LIST, nil, "Additional word characters in generic mode"},
+	{"generic_multiline", OPTION_BOOL, false, "Let ellipses match across lines with aliengrep"},
+	{"go_deeper_expr", OPTION_BOOL, true, "Match patterns nested in expressions"},
+	{"go_deeper_stmt", OPTION_BOOL, true, "Match patterns nested in statements"},
+	{"implicit_deep_exprstmt", OPTION_BOOL, true, "Match expression statements deep in expressions"},
+	{"implicit_ellipsis", OPTION_BOOL, true, "Match records with additional fields"},
+	{"interfile", OPTION_BOOL, false, "Run the rule with inter-file analysis"},
+	{"let_is_var", OPTION_BOOL, true, "Match let declarations with var patterns"},
+	{"max_match_per_file", OPTION_INT, nil, "Maximum number of matches reported per file"},
+	{"symbolic_propagation", OPTION_BOOL, false, "Match expressions through variables"},
+	{"taint_assume_safe_booleans", OPTION_BOOL, false, "Do not propagate taint through booleans"},
+	{"taint_assume_safe_comparisons", OPTION_BOOL, false, "Do not propagate taint through comparisons"},
+	{"taint_assume_safe_functions", OPTION_BOOL, false, "Do not propagate taint through function calls"},
+	{"taint_assume_safe_indexes", OPTION_BOOL, false, "Do not propagate taint through array indexes"},
+	{"taint_assume_safe_numbers", OPTION_BOOL, false, "Do not propagate taint through numbers"},
+	{"taint_only_propagate_through_assignments", OPTION_BOOL, false, "Only propagate taint through assignments"},
+	{"taint_unify_mvars", OPTION_BOOL, false, "Unify the metavariables of sources and sinks"},
+	{"unify_ids_strictly", OPTION_BOOL, true, "Only unify identifiers referring to the same entity"},
+	{"vardef_assign", OPTION_BOOL, true, "Match variable definitions with assignment patterns"},
+	{"xml_attrs_implicit_ellipsis", OPTION_BOOL, true, "Match XML elements with additional attributes"},
+	// keep-sorted end
+}
+
+// Find a known rule option by name.
+func LookupOption(name string) (OptionSpec, bool) {
+	for _, option := range Options {
+		if option.Name == name {
+			return option, true
+		}
+	}
+	return OptionSpec{}, false
+}
+
+// Convert the string value to the type of the option.
+func (o OptionSpec) Parse(value string) (any, error) {
+	switch o.Type {
+	case OPTION_BOOL:
+		return strconv.ParseBool(value)
+	case OPTION_INT:
+		return strconv.Atoi(value)
+	case OPTION_LIST:
+		return strings.Split(value, ","), nil
+	case OPTION_STRING:
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown option type '%s'", o.Type)
+}
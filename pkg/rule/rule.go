@@ -9,9 +9,26 @@ const (
 	SEVERITY_ERROR   = "ERROR"
 	SEVERITY_INFO    = "INFO"
 
-	MODE_TAINT = "taint"
+	MODE_TAINT   = "taint"
+	MODE_JOIN    = "join"
+	MODE_EXTRACT = "extract"
+
+	REDUCE_CONCAT   = "concat"
+	REDUCE_SEPARATE = "separate"
+
+	ANALYZER_ENTROPY = "entropy"
+	ANALYZER_REDOS   = "redos"
+
+	TAINT_SOURCES    = "pattern-sources"
+	TAINT_SINKS      = "pattern-sinks"
+	TAINT_SANITIZERS = "pattern-sanitizers"
 )
 
+var analyzers = map[string]bool{
+	ANALYZER_ENTROPY: true,
+	ANALYZER_REDOS:   true,
+}
+
 var severities = map[string]bool{
 	SEVERITY_WARNING: true,
 	SEVERITY_ERROR:   true,
@@ -19,19 +36,53 @@ var severities = map[string]bool{
 }
 
 type Rule struct {
-	Id        string         `yaml:"id"`
-	Severity  string         `yaml:"severity"`
-	Message   string         `yaml:"message,omitempty"`
-	Languages []string       `yaml:"languages"`
-	Fix       string         `yaml:"fix,omitempty"`
-	FixRegex  string         `yaml:"fix-regex,omitempty"`
-	Options   map[string]any `yaml:"options,omitempty"`
-	Metadata  map[string]any `yaml:"metadata,omitempty"`
-	Paths     *RulePaths     `yaml:"paths,omitempty"`
+	Id         string         `yaml:"id"`
+	Severity   string         `yaml:"severity"`
+	Message    string         `yaml:"message,omitempty"`
+	Languages  []string       `yaml:"languages"`
+	MinVersion string         `yaml:"min-version,omitempty"`
+	MaxVersion string         `yaml:"max-version,omitempty"`
+	Fix        string         `yaml:"fix,omitempty"`
+	FixRegex   string         `yaml:"fix-regex,omitempty"`
+	FixCount   int            `yaml:"-"`
+	Options    map[string]any `yaml:"options,omitempty"`
+	Metadata   map[string]any `yaml:"metadata,omitempty"`
+	Paths      *RulePaths     `yaml:"paths,omitempty"`
+
+	Patterns           *[]Pattern           `yaml:"patterns,omitempty"`
+	PatternSources     *[]TaintSpec         `yaml:"pattern-sources,omitempty"`
+	PatternSinks       *[]TaintSpec         `yaml:"pattern-sinks,omitempty"`
+	PatternSanitizers  *[]TaintSpec         `yaml:"pattern-sanitizers,omitempty"`
+	PatternPropagators *[]PatternPropagator `yaml:"pattern-propagators,omitempty"`
+
+	Join *RuleJoin `yaml:"join,omitempty"`
+
+	Extract      string   `yaml:"extract,omitempty"`
+	DestLanguage string   `yaml:"dest-language,omitempty"`
+	DestRules    []string `yaml:"dest-rules,omitempty"`
+	Transform    string   `yaml:"transform,omitempty"`
+	Reduce       string   `yaml:"reduce,omitempty"`
+
+	// keys of a loaded rule that semsearch does not know about
+	Extra yaml.MapSlice `yaml:"-"`
+	// top-level pattern key of a loaded rule
+	formula string
+	// rule loaded from a rule file
+	loaded bool
+	// the languages are the default language, replaced by the first language added
+	defaultLanguage bool
+	// the ID was numbered by State.Rule, not set
+	generatedID bool
+	// arguments that created the rule, set its ID, fix and extract
+	origin        Origin
+	idOrigin      Origin
+	fixOrigin     Origin
+	extractOrigin Origin
+}
 
-	Patterns       *[]Pattern `yaml:"patterns,omitempty"`
-	PatternSources *[]Pattern `yaml:"pattern-sources,omitempty"`
-	PatternSinks   *[]Pattern `yaml:"pattern-sinks,omitempty"`
+// Whether the ID was numbered by the builder rather than set.
+func (r *Rule) GeneratedID() bool {
+	return r.generatedID
 }
 
 func (r Rule) MarshalYAML() (any, error) {
@@ -47,6 +98,14 @@ func (r Rule) MarshalYAML() (any, error) {
 		yaml.MapItem{Key: "languages", Value: languages},
 	}
 
+	if r.MinVersion != "" {
+		items = append(items, yaml.MapItem{Key: "min-version", Value: r.MinVersion})
+	}
+
+	if r.MaxVersion != "" {
+		items = append(items, yaml.MapItem{Key: "max-version", Value: r.MaxVersion})
+	}
+
 	if r.Paths != nil {
 		if len(r.Paths.Exclude) > 0 {
 			items = append(items, yaml.MapItem{Key: "paths", Value: r.Paths})
@@ -59,20 +118,54 @@ func (r Rule) MarshalYAML() (any, error) {
 		items = append(items, yaml.MapItem{Key: "options", Value: r.Options})
 	}
 
-	if r.PatternSources != nil && len(*r.PatternSources) > 0 {
+	if r.Join != nil {
+		items = append(items,
+			yaml.MapItem{Key: "mode", Value: MODE_JOIN},
+			yaml.MapItem{Key: "join", Value: r.Join})
+	} else if r.PatternSources != nil && len(*r.PatternSources) > 0 {
 		items = append(items,
 			yaml.MapItem{Key: "mode", Value: MODE_TAINT},
-			yaml.MapItem{Key: "pattern-sources", Value: r.PatternSources},
-			yaml.MapItem{Key: "pattern-sinks", Value: r.PatternSinks})
+			yaml.MapItem{Key: "pattern-sources", Value: taintItems(r.PatternSources)},
+			yaml.MapItem{Key: "pattern-sinks", Value: taintItems(r.PatternSinks)})
+
+		if sanitizers := taintItems(r.PatternSanitizers); len(sanitizers) > 0 {
+			items = append(items, yaml.MapItem{Key: "pattern-sanitizers", Value: sanitizers})
+		}
+
+		if propagators := r.propagators(); len(propagators) > 0 {
+			items = append(items, yaml.MapItem{Key: "pattern-propagators", Value: propagators})
+		}
+	} else if r.Extract != "" {
+		items = append(items,
+			yaml.MapItem{Key: "mode", Value: MODE_EXTRACT},
+			r.formulaItem(),
+			yaml.MapItem{Key: "extract", Value: r.Extract},
+			yaml.MapItem{Key: "dest-language", Value: r.DestLanguage})
+
+		if len(r.DestRules) > 0 {
+			items = append(items, yaml.MapItem{Key: "dest-rules", Value: r.DestRules})
+		}
+
+		if r.Transform != "" {
+			items = append(items, yaml.MapItem{Key: "transform", Value: r.Transform})
+		}
+
+		if r.Reduce != "" {
+			items = append(items, yaml.MapItem{Key: "reduce", Value: r.Reduce})
+		}
 	} else if r.Patterns != nil && len(*r.Patterns) > 0 {
-		items = append(items, yaml.MapItem{Key: "patterns", Value: r.Patterns})
+		items = append(items, r.formulaItem())
 	}
 
 	if r.FixRegex != "" {
-		items = append(items, yaml.MapItem{Key: "fix-regex", Value: []yaml.MapItem{
+		fixRegex := yaml.MapSlice{
 			{Key: "regex", Value: r.FixRegex},
 			{Key: "replacement", Value: r.Fix},
-		}})
+		}
+		if r.FixCount > 0 {
+			fixRegex = append(fixRegex, yaml.MapItem{Key: "count", Value: r.FixCount})
+		}
+		items = append(items, yaml.MapItem{Key: "fix-regex", Value: fixRegex})
 	} else if r.Fix != "" {
 		items = append(items, yaml.MapItem{Key: "fix", Value: r.Fix})
 	}
@@ -81,22 +174,95 @@ func (r Rule) MarshalYAML() (any, error) {
 		items = append(items, yaml.MapItem{Key: "metadata", Value: r.Metadata})
 	}
 
+	items = append(items, r.Extra...)
+
 	return items, nil
 }
 
+// The patterns of the rule, kept in the top-level form of a loaded rule while
+// it only has that pattern.
+func (r Rule) formulaItem() yaml.MapItem {
+	if r.formula != "" && len(*r.Patterns) == 1 {
+		p := (*r.Patterns)[0]
+		switch {
+		case r.formula == "pattern" && p == Pattern{Pattern: p.Pattern}:
+			return yaml.MapItem{Key: r.formula, Value: p.Pattern}
+		case r.formula == "pattern-regex" && p == Pattern{PatternRegex: p.PatternRegex}:
+			return yaml.MapItem{Key: r.formula, Value: p.PatternRegex}
+		case r.formula == "pattern-either" && p == Pattern{PatternEither: p.PatternEither}:
+			return yaml.MapItem{Key: r.formula, Value: p.PatternEither}
+		}
+	}
+	return yaml.MapItem{Key: "patterns", Value: r.Patterns}
+}
+
+// Call f on every pattern of the rule, including nested patterns.
+func (r *Rule) walk(f func(p *Pattern)) {
+	walkPatterns(r.Patterns, f)
+	for _, specs := range []*[]TaintSpec{r.PatternSources, r.PatternSinks, r.PatternSanitizers} {
+		if specs == nil {
+			continue
+		}
+		for _, spec := range *specs {
+			walkPatterns(spec.Patterns, f)
+		}
+	}
+	if r.PatternPropagators != nil {
+		for _, p := range *r.PatternPropagators {
+			walkPatterns(p.Patterns, f)
+		}
+	}
+}
+
+func walkPatterns(patterns *[]Pattern, f func(p *Pattern)) {
+	if patterns == nil {
+		return
+	}
+	for i := range *patterns {
+		p := &(*patterns)[i]
+		f(p)
+		walkPatterns(p.Patterns, f)
+		walkPatterns(p.PatternEither, f)
+		if p.MetavariablePattern != nil {
+			walkPatterns(p.MetavariablePattern.Patterns, f)
+		}
+	}
+}
+
+// Flatten the propagator groups into one entry per pattern.
+func (r Rule) propagators() []propagatorItem {
+	items := []propagatorItem{}
+	if r.PatternPropagators == nil {
+		return items
+	}
+	for _, p := range *r.PatternPropagators {
+		for _, pattern := range *p.Patterns {
+			items = append(items, propagatorItem{Pattern: pattern, From: p.From, To: p.To})
+		}
+	}
+	return items
+}
+
 type Pattern struct {
-	Pattern             string               `yaml:"pattern,omitempty"`
-	PatternNot          string               `yaml:"pattern-not,omitempty"`
-	PatternInside       string               `yaml:"pattern-inside,omitempty"`
-	PatternNotInside    string               `yaml:"pattern-not-inside,omitempty"`
-	PatternRegex        string               `yaml:"pattern-regex,omitempty"`
-	PatternNotRegex     string               `yaml:"pattern-not-regex,omitempty"`
-	FocusMetavariable   string               `yaml:"focus-metavariable,omitempty"`
-	MetavariableRegex   *MetavariableRegex   `yaml:"metavariable-regex,omitempty"`
-	MetavariablePattern *MetavariablePattern `yaml:"metavariable-pattern,omitempty"`
+	Pattern                string                  `yaml:"pattern,omitempty"`
+	PatternNot             string                  `yaml:"pattern-not,omitempty"`
+	PatternInside          string                  `yaml:"pattern-inside,omitempty"`
+	PatternNotInside       string                  `yaml:"pattern-not-inside,omitempty"`
+	PatternRegex           string                  `yaml:"pattern-regex,omitempty"`
+	PatternNotRegex        string                  `yaml:"pattern-not-regex,omitempty"`
+	FocusMetavariable      string                  `yaml:"focus-metavariable,omitempty"`
+	MetavariableRegex      *MetavariableRegex      `yaml:"metavariable-regex,omitempty"`
+	MetavariablePattern    *MetavariablePattern    `yaml:"metavariable-pattern,omitempty"`
+	MetavariableType       *MetavariableType       `yaml:"metavariable-type,omitempty"`
+	MetavariableName       *MetavariableName       `yaml:"metavariable-name,omitempty"`
+	MetavariableComparison *MetavariableComparison `yaml:"metavariable-comparison,omitempty"`
+	MetavariableAnalysis   *MetavariableAnalysis   `yaml:"metavariable-analysis,omitempty"`
 
 	Patterns      *[]Pattern `yaml:"patterns,omitempty"`
 	PatternEither *[]Pattern `yaml:"pattern-either,omitempty"`
+
+	// argument that added the pattern
+	origin Origin
 }
 
 type MetavariableRegex struct {
@@ -104,11 +270,115 @@ type MetavariableRegex struct {
 	Regex        string `yaml:"regex,omitempty"`
 }
 
+type MetavariableComparison struct {
+	Metavariable string `yaml:"metavariable,omitempty"`
+	Comparison   string `yaml:"comparison"`
+	Base         int    `yaml:"base,omitempty"`
+	Strip        bool   `yaml:"strip,omitempty"`
+}
+
+type MetavariableAnalysis struct {
+	Metavariable string `yaml:"metavariable"`
+	Analyzer     string `yaml:"analyzer"`
+}
+
+type MetavariableType struct {
+	Metavariable string `yaml:"metavariable"`
+	Type         string `yaml:"type"`
+}
+
+type MetavariableName struct {
+	Metavariable string `yaml:"metavariable"`
+	Module       string `yaml:"module"`
+}
+
 type MetavariablePattern struct {
 	Metavariable string     `yaml:"metavariable,omitempty"`
+	Language     string     `yaml:"language,omitempty"`
+	PatternRegex string     `yaml:"pattern-regex,omitempty"`
 	Patterns     *[]Pattern `yaml:"patterns,omitempty"`
 }
 
+// A group of taint source, sink or sanitizer patterns sharing the same options.
+type TaintSpec struct {
+	Patterns     *[]Pattern
+	Label        string
+	Requires     string
+	BySideEffect string
+	Exact        *bool
+	Control      bool
+
+	// argument that started the group
+	origin Origin
+}
+
+type taintItem struct {
+	Pattern      `yaml:",inline"`
+	Label        string `yaml:"label,omitempty"`
+	Requires     string `yaml:"requires,omitempty"`
+	BySideEffect any    `yaml:"by-side-effect,omitempty"`
+	Exact        *bool  `yaml:"exact,omitempty"`
+	Control      bool   `yaml:"control,omitempty"`
+}
+
+// Flatten the taint groups into one entry per pattern.
+func taintItems(specs *[]TaintSpec) []taintItem {
+	items := []taintItem{}
+	if specs == nil {
+		return items
+	}
+	for _, spec := range *specs {
+		var bySideEffect any
+		switch spec.BySideEffect {
+		case "":
+		case "true", "false":
+			bySideEffect = spec.BySideEffect == "true"
+		default:
+			bySideEffect = spec.BySideEffect
+		}
+		for _, pattern := range *spec.Patterns {
+			items = append(items, taintItem{
+				Pattern:      pattern,
+				Label:        spec.Label,
+				Requires:     spec.Requires,
+				BySideEffect: bySideEffect,
+				Exact:        spec.Exact,
+				Control:      spec.Control,
+			})
+		}
+	}
+	return items
+}
+
+// A group of propagator patterns sharing the same from/to metavariables.
+type PatternPropagator struct {
+	Patterns *[]Pattern
+	From     string
+	To       string
+
+	// argument that started the group
+	origin Origin
+}
+
+type propagatorItem struct {
+	Pattern `yaml:",inline"`
+	From    string `yaml:"from"`
+	To      string `yaml:"to"`
+}
+
+// Combination of rules on shared metavariables.
+type RuleJoin struct {
+	Refs  []JoinRef `yaml:"refs,omitempty"`
+	Rules []*Rule   `yaml:"rules,omitempty"`
+	On    []string  `yaml:"on"`
+}
+
+// Reference to a rule defined in another file.
+type JoinRef struct {
+	Rule string `yaml:"rule"`
+	As   string `yaml:"as,omitempty"`
+}
+
 type RulePaths struct {
 	Include []string `yaml:"include,omitempty"`
 	Exclude []string `yaml:"exclude,omitempty"`
@@ -15,6 +15,8 @@ type Runner struct {
 	tmpDir string
 	// additional paths to scan
 	paths []string
+	// test the rules on the annotated paths
+	test bool
 }
 
 func NewRunner(state *State) *Runner {
@@ -23,12 +25,35 @@ func NewRunner(state *State) *Runner {
 	}
 }
 
+// Test the rules on the paths, whose comments annotate the expected matches
+// (ruleid: and ok:), instead of scanning them.
+func (r *Runner) Test() *Runner {
+	r.test = true
+	return r
+}
+
+// Write the rules and evals to a temporary directory. The directory is
+// removed when preparing fails, otherwise by Cleanup.
 func (r *Runner) Prepare() error {
+	rules, err := r.state.MarshalRules()
+	if err != nil {
+		return err
+	}
+
 	if err := r.createTempDir(); err != nil {
 		return err
 	}
 
-	if _, err := r.writeTempFile("rules.yaml", r.state.MarshalRules()); err != nil {
+	if err := r.writeTempFiles(rules); err != nil {
+		r.Cleanup()
+		return err
+	}
+
+	return nil
+}
+
+func (r *Runner) writeTempFiles(rules []byte) error {
+	if _, err := r.writeTempFile("rules.yaml", rules); err != nil {
 		return err
 	}
 
@@ -71,6 +96,12 @@ func (r *Runner) Args() []string {
 		"--disable-version-check",
 		fmt.Sprintf("--%s", r.state.format),
 	}
+	if r.test {
+		args = []string{"scan", "--test", "--disable-version-check"}
+		if r.state.format == "json" {
+			args = append(args, "--json")
+		}
+	}
 
 	for _, config := range r.state.configs {
 		args = append(args, "--config", config)
@@ -82,7 +113,7 @@ func (r *Runner) Args() []string {
 		args = append(args, "--scan-unknown-extensions")
 	}
 
-	if r.state.autofix {
+	if r.state.autofix && !r.test {
 		args = append(args, "--autofix")
 	}
 
@@ -92,6 +123,11 @@ func (r *Runner) Args() []string {
 		args = append(args, "--quiet")
 	}
 
+	for _, exclude := range r.state.excludes {
+		args = append(args, "--exclude", exclude)
+	}
+
+	args = append(args, r.state.engineArgs...)
 	args = append(args, r.paths...)
 	args = append(args, r.state.paths...)
 
@@ -99,19 +135,23 @@ func (r *Runner) Args() []string {
 }
 
 func (r *Runner) Run() error {
-	if len(r.state.warnings) > 0 {
-		for _, warning := range r.state.warnings {
-			fmt.Fprintln(os.Stderr, "Warning:", warning)
-		}
-	}
-
 	if r.state.debug {
-		fmt.Fprintln(os.Stderr, string(r.state.MarshalRules()))
+		rules, err := r.state.MarshalRules()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, r.state.Tree())
+		fmt.Fprintln(os.Stderr, string(rules))
 		fmt.Fprintf(os.Stderr, "command: %s %s\n", r.state.command, strings.Join(r.Args(), " "))
 	}
 
 	if r.state.export {
-		fmt.Print(string(r.state.MarshalRules()))
+		r.state.fillVersions()
+		rules, err := r.state.MarshalRules()
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(rules))
 		return nil
 	}
 
@@ -0,0 +1,15 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareInvalidRules(t *testing.T) {
+	state := Builder().Rule().Pattern("a").Patterns()
+	runner := NewRunner(state)
+
+	assert.Error(t, runner.Prepare())
+	assert.Empty(t, runner.tmpDir)
+}
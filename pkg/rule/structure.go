@@ -0,0 +1,101 @@
+package rule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Check that every pattern node holds exactly one pattern key, that groups
+// are not empty and that taint rules have both sources and sinks.
+func (s *State) checkStructure() error {
+	errs := append([]error{}, s.errors...)
+	for _, r := range s.rules {
+		errs = append(errs, r.checkStructure()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Rule) checkStructure() []error {
+	errs := []error{}
+
+	if r.Join != nil {
+		for _, sub := range r.Join.Rules {
+			errs = append(errs, sub.checkStructure()...)
+		}
+		return errs
+	}
+
+	sources := r.PatternSources != nil && len(*r.PatternSources) > 0
+	sinks := r.PatternSinks != nil && len(*r.PatternSinks) > 0
+	if sinks && !sources {
+		errs = append(errs, r.errorf((*r.PatternSinks)[0].origin, "pattern sinks without pattern sources"))
+	}
+
+	for _, specs := range []*[]TaintSpec{r.PatternSources, r.PatternSinks, r.PatternSanitizers} {
+		if specs == nil {
+			continue
+		}
+		for _, spec := range *specs {
+			if len(*spec.Patterns) == 0 {
+				errs = append(errs, r.errorf(spec.origin, "empty taint group"))
+			}
+		}
+	}
+
+	if r.PatternPropagators != nil {
+		for _, p := range *r.PatternPropagators {
+			if len(*p.Patterns) == 0 {
+				errs = append(errs, r.errorf(p.origin, "empty pattern propagator group"))
+			}
+			if p.From == "" || p.To == "" {
+				errs = append(errs, r.errorf(p.origin, "pattern propagator group needs both from and to metavariables"))
+			}
+		}
+	}
+
+	r.walk(func(p *Pattern) {
+		keys := p.keys()
+		switch {
+		case len(keys) == 0:
+			errs = append(errs, r.errorf(p.origin, "empty pattern"))
+			return
+		case len(keys) > 1:
+			errs = append(errs, r.errorf(p.origin, "pattern has more than one key: %s", strings.Join(keys, ", ")))
+			return
+		}
+
+		switch {
+		case p.Patterns != nil && len(*p.Patterns) == 0:
+			errs = append(errs, r.errorf(p.origin, "empty patterns group"))
+		case p.PatternEither != nil && len(*p.PatternEither) == 0:
+			errs = append(errs, r.errorf(p.origin, "empty pattern-either group"))
+		case p.MetavariablePattern != nil:
+			mp := p.MetavariablePattern
+			empty := mp.Patterns == nil || len(*mp.Patterns) == 0
+			if empty && mp.PatternRegex == "" {
+				errs = append(errs, r.errorf(p.origin, "empty metavariable-pattern group"))
+			} else if !empty && mp.PatternRegex != "" {
+				errs = append(errs, r.errorf(p.origin, "metavariable-pattern has both patterns and pattern-regex"))
+			}
+		}
+	})
+
+	return errs
+}
+
+// YAML keys set on the pattern node.
+func (p *Pattern) keys() []string {
+	keys := []string{}
+	v := reflect.ValueOf(*p)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || v.Field(i).IsZero() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
@@ -0,0 +1,60 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalRulesOrphanedPattern(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("foo").
+		Pop().
+		At(3, "-p").
+		Pattern("bar")
+
+	_, err := state.MarshalRules()
+	assert.EqualError(t, err, "rule-1: pattern added after leaving the top-level pattern group (argument 4: -p)")
+}
+
+func TestMarshalRulesMalformedPatterns(t *testing.T) {
+	state := Builder().
+		Rule().
+		At(0, "-pe").
+		PatternEither().
+		Pop().
+		At(2, "-mp").
+		MetavariablePattern("X").
+		Pop()
+	*state.rules[0].Patterns = append(*state.rules[0].Patterns,
+		Pattern{Pattern: "foo", PatternNot: "bar"},
+		Pattern{})
+
+	_, err := state.MarshalRules()
+	assert.EqualError(t, err, `rule-1: empty pattern-either group (argument 1: -pe)
+rule-1: empty metavariable-pattern group (argument 3: -mp)
+rule-1: pattern has more than one key: pattern, pattern-not
+rule-1: empty pattern`)
+}
+
+func TestMarshalRulesTaintStructure(t *testing.T) {
+	state := Builder().
+		Rule().
+		At(0, "-psk").
+		PatternSinks().
+		Pattern("sink").
+		Rule().
+		PatternSources().
+		Pattern("source").
+		At(3, "-psk").
+		PatternSinks().
+		At(5, "-ppr").
+		PatternPropagators().
+		Pattern("$TO.add($FROM)")
+
+	_, err := state.MarshalRules()
+	assert.EqualError(t, err, `rule-1: pattern sinks without pattern sources (argument 1: -psk)
+rule-2: empty taint group (argument 4: -psk)
+rule-2: pattern propagator group needs both from and to metavariables (argument 6: -ppr)`)
+}
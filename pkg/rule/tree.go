@@ -0,0 +1,183 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number of pattern groups opened in the current rule, -1 after leaving the
+// top-level pattern group.
+func (s *State) Depth() int {
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] == nil {
+		return -1
+	}
+	return len(s.stack) - 1
+}
+
+// Render the patterns of the rules as a tree.
+//
+//	rule-1
+//	└─ patterns
+//	   ├─ pattern: foo($X)
+//	   └─ pattern-either
+//	      ├─ pattern: $X == 1
+//	      └─ pattern: $X == 2
+func (s *State) Tree() string {
+	var b strings.Builder
+	for _, r := range s.rules {
+		b.WriteString(r.Id + "\n")
+		writeTree(&b, "", r.nodes())
+	}
+	return b.String()
+}
+
+type treeNode struct {
+	label    string
+	children []treeNode
+}
+
+func (r *Rule) nodes() []treeNode {
+	nodes := []treeNode{}
+	if r.Patterns != nil && len(*r.Patterns) > 0 {
+		nodes = append(nodes, patternsNode("patterns", *r.Patterns))
+	}
+	nodes = append(nodes, taintNodes(TAINT_SOURCES, r.PatternSources)...)
+	nodes = append(nodes, taintNodes(TAINT_SINKS, r.PatternSinks)...)
+	nodes = append(nodes, taintNodes(TAINT_SANITIZERS, r.PatternSanitizers)...)
+	if r.PatternPropagators != nil {
+		for _, p := range *r.PatternPropagators {
+			label := fmt.Sprintf("pattern-propagators (from: %s, to: %s)", p.From, p.To)
+			nodes = append(nodes, patternsNode(label, *p.Patterns))
+		}
+	}
+	if r.Join != nil {
+		nodes = append(nodes, r.Join.node())
+	}
+	return nodes
+}
+
+// Sub-rules, references and conditions of a join rule.
+func (j *RuleJoin) node() treeNode {
+	node := treeNode{label: "join"}
+	for _, r := range j.Rules {
+		node.children = append(node.children, treeNode{label: r.Id, children: r.nodes()})
+	}
+	for _, ref := range j.Refs {
+		label := "ref: " + ref.Rule
+		if ref.As != "" {
+			label += " as " + ref.As
+		}
+		node.children = append(node.children, treeNode{label: label})
+	}
+	for _, condition := range j.On {
+		node.children = append(node.children, treeNode{label: "on: " + condition})
+	}
+	return node
+}
+
+func taintNodes(section string, specs *[]TaintSpec) []treeNode {
+	if specs == nil {
+		return nil
+	}
+	nodes := []treeNode{}
+	for _, spec := range *specs {
+		label := section
+		if attributes := spec.attributes(); len(attributes) > 0 {
+			label += " (" + strings.Join(attributes, ", ") + ")"
+		}
+		nodes = append(nodes, patternsNode(label, *spec.Patterns))
+	}
+	return nodes
+}
+
+// Options of the taint group as written in the tree.
+func (t *TaintSpec) attributes() []string {
+	attributes := []string{}
+	if t.Label != "" {
+		attributes = append(attributes, "label: "+t.Label)
+	}
+	if t.Requires != "" {
+		attributes = append(attributes, "requires: "+t.Requires)
+	}
+	if t.BySideEffect != "" {
+		attributes = append(attributes, "by-side-effect: "+t.BySideEffect)
+	}
+	if t.Exact != nil {
+		attributes = append(attributes, fmt.Sprintf("exact: %t", *t.Exact))
+	}
+	if t.Control {
+		attributes = append(attributes, "control")
+	}
+	return attributes
+}
+
+func patternsNode(label string, patterns []Pattern) treeNode {
+	node := treeNode{label: label}
+	for i := range patterns {
+		node.children = append(node.children, patterns[i].node())
+	}
+	return node
+}
+
+func (p *Pattern) node() treeNode {
+	switch {
+	case p.Patterns != nil:
+		return patternsNode("patterns", *p.Patterns)
+	case p.PatternEither != nil:
+		return patternsNode("pattern-either", *p.PatternEither)
+	case p.MetavariablePattern != nil:
+		m := p.MetavariablePattern
+		label := "metavariable-pattern " + m.Metavariable
+		if m.Language != "" {
+			label += ":" + m.Language
+		}
+		if m.PatternRegex != "" {
+			return treeNode{label: label, children: []treeNode{{label: "pattern-regex: " + strconv.Quote(m.PatternRegex)}}}
+		}
+		if m.Patterns == nil {
+			return treeNode{label: label}
+		}
+		return patternsNode(label, *m.Patterns)
+	case p.MetavariableRegex != nil:
+		return treeNode{label: fmt.Sprintf("metavariable-regex: %s =~ %s", p.MetavariableRegex.Metavariable, p.MetavariableRegex.Regex)}
+	case p.MetavariableComparison != nil:
+		return treeNode{label: "metavariable-comparison: " + p.MetavariableComparison.Comparison}
+	case p.MetavariableAnalysis != nil:
+		return treeNode{label: fmt.Sprintf("metavariable-analysis: %s (%s)", p.MetavariableAnalysis.Metavariable, p.MetavariableAnalysis.Analyzer)}
+	case p.MetavariableType != nil:
+		return treeNode{label: fmt.Sprintf("metavariable-type: %s: %s", p.MetavariableType.Metavariable, p.MetavariableType.Type)}
+	case p.MetavariableName != nil:
+		return treeNode{label: fmt.Sprintf("metavariable-name: %s: %s", p.MetavariableName.Metavariable, p.MetavariableName.Module)}
+	}
+
+	keys := p.keys()
+	if len(keys) == 0 {
+		return treeNode{label: "(empty)"}
+	}
+	values := map[string]string{
+		"pattern":            p.Pattern,
+		"pattern-not":        p.PatternNot,
+		"pattern-inside":     p.PatternInside,
+		"pattern-not-inside": p.PatternNotInside,
+		"pattern-regex":      p.PatternRegex,
+		"pattern-not-regex":  p.PatternNotRegex,
+		"focus-metavariable": p.FocusMetavariable,
+	}
+	value := values[keys[0]]
+	if strings.Contains(value, "\n") {
+		value = strconv.Quote(value)
+	}
+	return treeNode{label: fmt.Sprintf("%s: %s", keys[0], value)}
+}
+
+func writeTree(b *strings.Builder, indent string, nodes []treeNode) {
+	for i, node := range nodes {
+		branch, next := "├─ ", "│  "
+		if i == len(nodes)-1 {
+			branch, next = "└─ ", "   "
+		}
+		b.WriteString(indent + branch + node.label + "\n")
+		writeTree(b, indent+next, node.children)
+	}
+}
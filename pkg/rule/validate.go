@@ -0,0 +1,179 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	metavariableRegex = regexp.MustCompile(`\$(\.\.\.)?[A-Z_][A-Z0-9_]*`)
+	namedGroupRegex   = regexp.MustCompile(`\(\?P?<([A-Za-z_][A-Za-z0-9_]*)>`)
+)
+
+// Check the rules for problems that would make the engine fail or silently
+// match nothing. Suspicious rules that may still be intended are added to the
+// warnings.
+func (s *State) Validate() error {
+	problems := []error{}
+	problems = append(problems, validateIDs(s.rules)...)
+	for _, r := range s.rules {
+		// the rules are only checked further once they can be serialized
+		if errs := r.checkStructure(); len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		problems = append(problems, r.validate()...)
+	}
+
+	errs := []error{}
+	for _, problem := range problems {
+		if d, ok := problem.(*Diagnostic); ok && d.Severity == DIAGNOSTIC_WARNING {
+			s.warnings = append(s.warnings, d)
+			continue
+		}
+		errs = append(errs, problem)
+	}
+	return errors.Join(errs...)
+}
+
+func validateIDs(rules []*Rule) []error {
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if seen[r.Id] {
+			origin := r.idOrigin
+			if origin.Flag == "" {
+				origin = r.origin
+			}
+			errs = append(errs, r.errorf(origin, "rule ID is used by another rule"))
+		}
+		seen[r.Id] = true
+	}
+	return errs
+}
+
+func (r *Rule) validate() []error {
+	if r.Join != nil {
+		errs := validateIDs(r.Join.Rules)
+		for _, sub := range r.Join.Rules {
+			errs = append(errs, sub.validate()...)
+		}
+		if len(r.Join.Rules) == 0 && len(r.Join.Refs) == 0 {
+			errs = append(errs, r.errorf(r.origin, "join rule has no rules to join"))
+		}
+		return errs
+	}
+
+	sources := r.PatternSources != nil && len(*r.PatternSources) > 0
+	sinks := r.PatternSinks != nil && len(*r.PatternSinks) > 0
+	patterns := r.Patterns != nil && len(*r.Patterns) > 0
+
+	switch {
+	case sources && !sinks:
+		return []error{r.errorf((*r.PatternSources)[0].origin, "taint rule has pattern sources but no pattern sinks")}
+	case sinks && !sources:
+		return []error{r.errorf((*r.PatternSinks)[0].origin, "taint rule has pattern sinks but no pattern sources")}
+	case !sources && !patterns && len(r.Extra) == 0:
+		return []error{r.errorf(r.origin, "rule has no patterns")}
+	}
+
+	errs := r.validateMetavariables()
+	if r.Extract != "" && r.DestLanguage == "" {
+		errs = append(errs, r.errorf(r.extractOrigin, "extract rule needs --dest-language"))
+	}
+	return errs
+}
+
+// Check that the metavariables used by the rule are bound by a positive
+// pattern of the rule.
+func (r *Rule) validateMetavariables() []error {
+	errs := []error{}
+	bound := r.boundMetavariables()
+
+	check := func(origin Origin, metavariable string, usage string) {
+		if !bound[metavariable] {
+			errs = append(errs, r.errorf(origin, "metavariable %s used in %s is not bound by any pattern", metavariable, usage))
+		}
+	}
+
+	r.walk(func(p *Pattern) {
+		switch {
+		case p.FocusMetavariable != "":
+			check(p.origin, p.FocusMetavariable, "focus-metavariable")
+		case p.MetavariableRegex != nil:
+			check(p.origin, p.MetavariableRegex.Metavariable, "metavariable-regex")
+		case p.MetavariablePattern != nil:
+			check(p.origin, p.MetavariablePattern.Metavariable, "metavariable-pattern")
+		case p.MetavariableAnalysis != nil:
+			check(p.origin, p.MetavariableAnalysis.Metavariable, "metavariable-analysis")
+		case p.MetavariableType != nil:
+			check(p.origin, p.MetavariableType.Metavariable, "metavariable-type")
+		case p.MetavariableName != nil:
+			check(p.origin, p.MetavariableName.Metavariable, "metavariable-name")
+		case p.MetavariableComparison != nil:
+			for _, metavariable := range metavariableRegex.FindAllString(p.MetavariableComparison.Comparison, -1) {
+				check(p.origin, metavariable, "metavariable-comparison")
+			}
+		}
+	})
+
+	// the fix may contain a literal $, such as shell or PHP code
+	if r.Fix != "" && r.FixRegex == "" {
+		for _, metavariable := range metavariableRegex.FindAllString(r.Fix, -1) {
+			if !bound[metavariable] {
+				errs = append(errs, r.warnf(r.fixOrigin, "metavariable %s used in fix is not bound by any pattern, it is kept as text", metavariable))
+			}
+		}
+	}
+
+	if r.Extract != "" {
+		check(r.extractOrigin, r.Extract, "extract")
+	}
+
+	return errs
+}
+
+// Metavariables bound by the positive patterns of the rule.
+func (r *Rule) boundMetavariables() map[string]bool {
+	bound := map[string]bool{}
+	bind := func(pattern string) {
+		for _, metavariable := range metavariableRegex.FindAllString(pattern, -1) {
+			bound[metavariable] = true
+		}
+	}
+
+	bindGroups := func(regex string) {
+		for _, group := range namedGroupRegex.FindAllStringSubmatch(regex, -1) {
+			bound["$"+group[1]] = true
+		}
+	}
+
+	r.walk(func(p *Pattern) {
+		bind(p.Pattern)
+		bind(p.PatternInside)
+		bindGroups(p.PatternRegex)
+		if p.MetavariableRegex != nil {
+			bindGroups(p.MetavariableRegex.Regex)
+		}
+	})
+
+	return bound
+}
+
+func (r *Rule) errorf(origin Origin, format string, args ...any) error {
+	return r.diagnostic(DIAGNOSTIC_ERROR, origin, fmt.Sprintf(format, args...))
+}
+
+func (r *Rule) warnf(origin Origin, format string, args ...any) error {
+	return r.diagnostic(DIAGNOSTIC_WARNING, origin, fmt.Sprintf(format, args...))
+}
+
+func (r *Rule) diagnostic(severity DiagnosticSeverity, origin Origin, message string) *Diagnostic {
+	return &Diagnostic{
+		Origin:   origin,
+		Severity: severity,
+		Rule:     r.Id,
+		Message:  message,
+	}
+}
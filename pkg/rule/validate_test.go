@@ -0,0 +1,147 @@
+package rule
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validationErrors(t *testing.T, s *State) []*Diagnostic {
+	t.Helper()
+	err := s.Validate()
+	if err == nil {
+		return nil
+	}
+	errs := []*Diagnostic{}
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var v *Diagnostic
+		if assert.True(t, errors.As(e, &v)) {
+			errs = append(errs, v)
+		}
+	}
+	return errs
+}
+
+func TestValidateValidRules(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("foo($X, $...ARGS)").
+		FocusMetavariable("X").
+		MetavariableRegex("X", "^(?P<NAME>[a-z]+)$").
+		MetavariableComparison("$NAME != 'x'").
+		MetavariablePattern("...ARGS").
+		Pattern("$Y").
+		Pop().
+		Fix("bar($X, $Y)").
+		Rule().
+		PatternRegex(`key=(?P<KEY>\w+)`).
+		MetavariableAnalysis("KEY", "entropy").
+		Rule().
+		PatternSources().
+		Pattern("input()").
+		PatternSinks().
+		Pattern("exec(...)")
+
+	assert.Empty(t, validationErrors(t, state))
+}
+
+func TestValidateUnboundMetavariables(t *testing.T) {
+	state := Builder().
+		At(0, "-p").
+		Rule().
+		At(1, "-fm").
+		FocusMetavariable("FOO").
+		At(3, "-p").
+		Pattern("foo($X)").
+		At(5, "-pn").
+		PatternNot("foo($Y)").
+		At(7, "-mr").
+		MetavariableRegex("Y", "abc").
+		At(9, "-fx").
+		Fix("bar($X, $Z)")
+
+	errs := validationErrors(t, state)
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, Origin{Index: 1, Flag: "-fm"}, errs[0].Origin)
+		assert.Equal(t, "rule-1: metavariable $FOO used in focus-metavariable is not bound by any pattern (argument 2: -fm)", errs[0].Error())
+		assert.Equal(t, Origin{Index: 7, Flag: "-mr"}, errs[1].Origin)
+	}
+	if warnings := state.Warnings(); assert.Len(t, warnings, 1) {
+		assert.Equal(t, Origin{Index: 9, Flag: "-fx"}, warnings[0].Origin)
+		assert.Equal(t, DIAGNOSTIC_WARNING, warnings[0].Severity)
+	}
+}
+
+func TestValidateFixWithLiteralDollar(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("echo $X").
+		At(3, "--fix").
+		Fix(`echo "$X in $HOME"; $PHP_VAR = 1`)
+
+	assert.Empty(t, validationErrors(t, state))
+	messages := []string{}
+	for _, warning := range state.Warnings() {
+		messages = append(messages, warning.Error())
+	}
+	assert.Equal(t, []string{
+		"rule-1: metavariable $HOME used in fix is not bound by any pattern, it is kept as text (argument 4: --fix)",
+		"rule-1: metavariable $PHP_VAR used in fix is not bound by any pattern, it is kept as text (argument 4: --fix)",
+	}, messages)
+}
+
+func TestValidateRules(t *testing.T) {
+	state := Builder().
+		Rule().
+		At(1, "--rule").
+		Rule().
+		Pattern("foo").
+		At(4, "--id").
+		ID("rule-1").
+		At(6, "--rule").
+		Rule().
+		PatternSources().
+		Pattern("input()")
+
+	errs := validationErrors(t, state)
+	if assert.Len(t, errs, 3) {
+		assert.Equal(t, "rule-1: rule ID is used by another rule (argument 5: --id)", errs[0].Error())
+		assert.Equal(t, "rule-1: rule has no patterns", errs[1].Error())
+		assert.Equal(t, "rule-3: taint rule has pattern sources but no pattern sinks (argument 7: --rule)", errs[2].Error())
+	}
+}
+
+func TestValidateStructure(t *testing.T) {
+	state := Builder().
+		Rule().
+		At(0, "-p").
+		Pattern("a").
+		At(2, "-ps").
+		Patterns().
+		At(3, "^").
+		Pop()
+
+	errs := validationErrors(t, state)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "rule-1: empty patterns group (argument 3: -ps)", errs[0].Error())
+		assert.Equal(t, Origin{Index: 2, Flag: "-ps"}, errs[0].Origin)
+	}
+}
+
+func TestValidateExtractWithoutDestLanguage(t *testing.T) {
+	state := Builder().
+		Rule().
+		Pattern("$X").
+		At(2, "--extract").
+		Extract("X")
+
+	errs := validationErrors(t, state)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "rule-1: extract rule needs --dest-language (argument 3: --extract)", errs[0].Error())
+		assert.Equal(t, Origin{Index: 2, Flag: "--extract"}, errs[0].Origin)
+	}
+
+	state.DestLanguage("python")
+	assert.Empty(t, validationErrors(t, state))
+}
@@ -0,0 +1,146 @@
+package rule
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ENGINE_OPENGREP = "opengrep"
+	ENGINE_SEMGREP  = "semgrep"
+)
+
+// First version of each engine supporting the rule features that are not
+// available in every release of the engine. Opengrep was forked from Semgrep
+// after all of them were added and has its own version numbers, so it has no
+// versions.
+var featureVersions = map[string]map[string]string{
+	ENGINE_SEMGREP: {
+		// keep-sorted start
+		"by-side-effect":                "1.46.0",
+		"metavariable-analysis":         "0.50.0",
+		"metavariable-comparison":       "0.24.0",
+		"metavariable-name":             "1.79.0",
+		"metavariable-pattern-language": "0.74.0",
+		"metavariable-type":             "1.21.0",
+		"mode-extract":                  "0.102.0",
+		"mode-join":                     "0.63.0",
+		"pattern-propagators":           "0.89.0",
+		"taint-labels":                  "0.95.0",
+		// keep-sorted end
+	},
+}
+
+// Engine run by the command, from the name of its executable.
+func (s *State) engine() string {
+	name := strings.TrimSuffix(filepath.Base(s.command), ".exe")
+	if name == ENGINE_SEMGREP {
+		return ENGINE_SEMGREP
+	}
+	return ENGINE_OPENGREP
+}
+
+// Features used by the rule that require a recent engine.
+func (r *Rule) features() []string {
+	features := []string{}
+
+	switch {
+	case r.Join != nil:
+		features = append(features, "mode-join")
+		for _, sub := range r.Join.Rules {
+			features = append(features, sub.features()...)
+		}
+	case r.Extract != "":
+		features = append(features, "mode-extract")
+	}
+
+	if r.PatternPropagators != nil && len(*r.PatternPropagators) > 0 {
+		features = append(features, "pattern-propagators")
+	}
+
+	for _, specs := range []*[]TaintSpec{r.PatternSources, r.PatternSinks, r.PatternSanitizers} {
+		if specs == nil {
+			continue
+		}
+		for _, spec := range *specs {
+			if spec.Label != "" || spec.Requires != "" {
+				features = append(features, "taint-labels")
+			}
+			if spec.BySideEffect != "" {
+				features = append(features, "by-side-effect")
+			}
+		}
+	}
+
+	r.walk(func(p *Pattern) {
+		switch {
+		case p.MetavariableComparison != nil:
+			features = append(features, "metavariable-comparison")
+		case p.MetavariableAnalysis != nil:
+			features = append(features, "metavariable-analysis")
+		case p.MetavariableType != nil:
+			features = append(features, "metavariable-type")
+		case p.MetavariableName != nil:
+			features = append(features, "metavariable-name")
+		case p.MetavariablePattern != nil && p.MetavariablePattern.Language != "":
+			features = append(features, "metavariable-pattern-language")
+		}
+	})
+
+	return features
+}
+
+// Minimum version of the engine required by the features of the rule, empty
+// when any version will do.
+func (r *Rule) requiredVersion(engine string) string {
+	required := ""
+	for _, feature := range r.features() {
+		if version := featureVersions[engine][feature]; compareVersions(version, required) > 0 {
+			required = version
+		}
+	}
+	return required
+}
+
+// Set the min-version of the rules without one from the features they use
+// and the engine of the command. Loaded rules are left as they were written.
+func (s *State) fillVersions() {
+	for _, r := range s.rules {
+		if r.MinVersion == "" && !r.loaded {
+			r.MinVersion = r.requiredVersion(s.engine())
+		}
+	}
+}
+
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// Compare two versions, an empty or invalid version is lower than any other.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := 0; i < max(len(va), len(vb)); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return len(va) - len(vb)
+}